@@ -0,0 +1,216 @@
+// Package app はハンズオンで作った機能をすべて組み合わせたBot
+// example/Step4.go と cmd/botcli は同じ Register を使うので、どちらでも同じ返信になる
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+	"github.com/xxarupakaxx/sysad-linebot-handson/config"
+	"github.com/xxarupakaxx/sysad-linebot-handson/omikuji"
+	"github.com/xxarupakaxx/sysad-linebot-handson/todo"
+	"github.com/xxarupakaxx/sysad-linebot-handson/weather"
+)
+
+// Option は Register の設定
+type Option func(*options)
+
+type options struct {
+	// jobs は決まった時刻にプッシュメッセージを送る裏側の処理を動かすかどうか
+	jobs bool
+	// weatherProvider は天気の情報を取得するサービス。nil のときは cfg から作る
+	weatherProvider weather.Provider
+}
+
+// WithJobs はリマインダーなど、決まった時刻にプッシュメッセージを送る裏側の処理も動かす
+// LINEに本当にメッセージを送ってしまうので、cmd/botcli のような試すためのコマンドでは使わない
+func WithJobs() Option {
+	return func(o *options) {
+		o.jobs = true
+	}
+}
+
+// WithWeatherProvider は天気の情報を cfg で指定したサービスの代わりに provider から取得する
+// テストで weathertest.Fake を使うときなどに指定する
+func WithWeatherProvider(provider weather.Provider) Option {
+	return func(o *options) {
+		o.weatherProvider = provider
+	}
+}
+
+// Register はすべての機能の処理を server に登録する
+// db が nil のときはTodoListを、天気の情報を取得するサービスの設定が足りないときは天気確認を登録しない
+// cfg.Admins のユーザーは、共有しているTodoListで他の人のTodoも削除できる
+// 裏側の処理は WithJobs を渡したときだけ動かす
+func Register(server *bot.Server, cfg *config.Config, db *sqlx.DB, opts ...Option) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// TodoListはデータベースがあるときだけ使う
+	var todoService *todo.Service
+	if db != nil {
+		var err error
+		if todoService, err = todo.New(context.Background(), db, todo.WithAdmins(cfg.Admins...), todo.WithReminders(cfg.TodoReminders...)); err != nil {
+			log.Printf("TodoListは使えません: %v", err)
+		}
+	}
+
+	// メッセージが来たときに返信を生成する処理を登録する
+	// クイックリプライなどのポストバックは、それを送った機能の処理に振り分ける
+	postbacks := bot.NewPostbackRouter()
+	router, weatherClient := newRouter(server, cfg, db, todoService, postbacks, o)
+	server.HandleMessage(router.HandleMessage)
+	server.HandlePostback(postbacks.HandlePostback)
+	// 友だち追加されたときやグループに招待されたときの処理を登録する
+	server.HandleFollow(replyGreeting)
+	server.HandleJoin(replyGreeting)
+	server.HandleMemberJoined(replyWelcome)
+	// ブロックされたときやグループから退出させられたときの処理を登録する
+	// もうメッセージを送れないので、そのユーザー・グループのTodoListと天気予報の登録・設定を削除する
+	server.HandleUnfollow(forgetSource("unfollowed", todoService, weatherClient))
+	server.HandleLeave(forgetSource("left", todoService, weatherClient))
+}
+
+const helpMessage = `使い方
+テキストメッセージ:
+	"おみくじ"がメッセージに入ってれば今日の運勢を占うよ！
+	"ヘルプ"って送ればこの使い方を返すよ！
+	"天気 東京" や "weather Sapporo tomorrow" のように送ればその場所の天気予報を答えるよ！
+	"天気 東京 5日" で5日分を、"天気 東京 3時間ごと" でこれから24時間の天気予報を答えるよ！
+	"天気 登録 東京 07:00" で毎日その時刻に天気予報を送るよ！("天気 一覧" "天気 解除 登録番号" で確認・解除)
+	"天気 警報 登録番号 雨 60" で雨が降りそうなときに知らせるよ！("天気 警報" で使い方)
+	"天気 単位 華氏" でこのトークでは気温を℉、風速をmphで答えるよ！("天気 単位 摂氏" で元に戻す)
+	それ以外はやまびこを返すよ！
+スタンプ:
+	スタンプの情報を答えるよ！
+位置情報:
+	その場所の天気・気温・湿度・風速を答えるよ！
+` + todo.HelpMessage + `
+それ以外:
+	それ以外にはまだ対応してないよ！ごめんね...`
+
+// 来たメッセージによって返信を生成する処理を登録する
+// 優先度の大きいものから順に判定される
+// ポストバックを使う機能は postbacks にも処理を登録する
+// 決まった時刻にプッシュメッセージを送る機能は、o.jobs のときだけ server で裏側の処理を動かす
+// 天気確認を登録したときは、その Client も返す
+func newRouter(server *bot.Server, cfg *config.Config, db *sqlx.DB, todoService *todo.Service, postbacks *bot.PostbackRouter, o options) (*bot.Router, *weather.Client) {
+	router := bot.NewRouter()
+	// 「todo」で始まるとき
+	// 「おみくじ」を含むメッセージでもTodoの操作を優先する
+	if todoService != nil {
+		router.Handle(10, bot.Word("todo"), todoService.Handler)
+		// 期限が近づいたTodoのリマインダーを送り、そのボタンが押されたときの処理を登録する
+		if o.jobs {
+			server.Go(todo.NewScheduler(todoService, server.Client).Job())
+		}
+		postbacks.Handle(todo.PostbackAction, todoService.PostbackHandler)
+	}
+	// 「おみくじ」という文字列が含まれているとき
+	router.Handle(0, bot.Regexp(regexp.MustCompile("おみくじ")), omikuji.Handler)
+	// 「ヘルプ」と送られたとき
+	router.Handle(0, bot.Word("ヘルプ"), replyHelp)
+	// スタンプが来たとき
+	router.Handle(0, bot.MessageType(linebot.MessageTypeSticker), replySticker)
+	// 位置情報が来たとき
+	var weatherClient *weather.Client
+	provider, err := weather.NewProvider(cfg.WeatherProvider, cfg.AppID)
+	if o.weatherProvider != nil {
+		provider, err = o.weatherProvider, nil
+	}
+	if err == nil {
+		// 同じ場所の問い合わせは覚えた結果を使い、問い合わせすぎないように制限する
+		limiter := weather.NewRateLimited(provider, cfg.WeatherRateLimit, cfg.WeatherRateBurst)
+		provider = weather.NewCache(limiter)
+		// 地名は手元の一覧で調べ、見つからなければOpenWeatherMapAPIで調べる
+		// 地名の検索も天気の問い合わせと同じ上限で数える
+		geocoder := weather.Geocoders{weather.NewGazetteer()}
+		if cfg.AppID != "" {
+			geocoder = append(geocoder, limiter.Geocoder(weather.NewOpenWeatherMap(cfg.AppID)))
+		}
+		opts := []weather.ClientOption{weather.WithGeocoder(geocoder)}
+		// データベースがあれば、毎日決まった時刻に天気予報を送る登録を使えるようにする
+		var subscriptions *weather.SubscriptionStore
+		if db != nil {
+			if subscriptions, err = weather.NewSubscriptionStore(context.Background(), db); err == nil {
+				opts = append(opts, weather.WithSubscriptions(subscriptions))
+			} else {
+				log.Printf("天気予報の登録は使えません: %v", err)
+			}
+			// 単位系の設定もデータベースに保存して、再起動しても消えないようにする
+			if preferences, err := weather.NewMySQLPreferenceStore(context.Background(), db); err == nil {
+				opts = append(opts, weather.WithPreferences(preferences))
+			} else {
+				log.Printf("単位系の設定はメモリに保存します: %v", err)
+			}
+		}
+		weatherClient = weather.New(provider, opts...)
+		if subscriptions != nil && o.jobs {
+			// 登録した時刻に天気予報を送り、警報の条件に合ったら知らせる
+			scheduler := weather.NewScheduler(weatherClient, subscriptions, server.Client)
+			server.Go(scheduler.Job())
+			server.Go(scheduler.AlertJob())
+		}
+		// 「天気 東京」のように地名が送られたとき
+		router.Handle(0, weather.IsPlaceCommand, weatherClient.PlaceHandler)
+		router.Handle(0, bot.MessageType(linebot.MessageTypeLocation), weatherClient.CurrentHandler)
+		// クイックリプライで天気予報の見せ方が選ばれたとき
+		postbacks.Handle(weather.PostbackAction, weatherClient.PostbackHandler)
+	} else {
+		log.Printf("天気確認は使えません: %v", err)
+	}
+	// それ以外のとき
+	router.Fallback(replyEcho)
+	return router, weatherClient
+}
+
+// 使い方を返す
+func replyHelp(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	return linebot.NewTextMessage(helpMessage)
+}
+
+// スタンプの情報を返す
+func replySticker(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	message := event.Message.(*linebot.StickerMessage)
+	return linebot.NewTextMessage(fmt.Sprintf("sticker id is %v, stickerResourceType is %v", message.StickerID, message.StickerResourceType))
+}
+
+// テキストメッセージならオウム返しし、それ以外ならヘルプを返す
+func replyEcho(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	if text, ok := bot.Text(event); ok {
+		return linebot.NewTextMessage(text)
+	}
+	return linebot.NewTextMessage(helpMessage)
+}
+
+// あいさつと使い方を返す
+func replyGreeting(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	return linebot.NewTextMessage("はじめまして！よろしくね！\n\n" + helpMessage)
+}
+
+// 新しく参加したメンバーを歓迎する
+func replyWelcome(ctx context.Context, event *linebot.Event, members []*linebot.EventSource) linebot.SendingMessage {
+	return linebot.NewTextMessage(fmt.Sprintf("%d人のメンバーが参加したよ！\n使い方が知りたいときは「ヘルプ」って送ってね！", len(members)))
+}
+
+// 返信できないイベントの送信元を記録し、その送信元のTodoListと天気予報の登録・設定を削除する
+// todoService や weatherClient が nil のときは、その機能のデータは削除しない
+func forgetSource(action string, todoService *todo.Service, weatherClient *weather.Client) func(ctx context.Context, source *linebot.EventSource) {
+	return func(ctx context.Context, source *linebot.EventSource) {
+		log.Printf("%s: type=%s user=%s group=%s room=%s", action, source.Type, source.UserID, source.GroupID, source.RoomID)
+		if todoService != nil {
+			todoService.Forget(ctx, source)
+		}
+		if weatherClient != nil {
+			weatherClient.Forget(ctx, source)
+		}
+	}
+}
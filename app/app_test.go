@@ -0,0 +1,112 @@
+package app_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/app"
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+	"github.com/xxarupakaxx/sysad-linebot-handson/config"
+	"github.com/xxarupakaxx/sysad-linebot-handson/linetest"
+	"github.com/xxarupakaxx/sysad-linebot-handson/todo"
+	"github.com/xxarupakaxx/sysad-linebot-handson/weather/weathertest"
+)
+
+// startBot は app.Register ですべての機能を登録したBotを起動する
+// 天気はフィクスチャを返す weathertest.Fake から取得する
+func startBot(t *testing.T, cfg *config.Config, db *sqlx.DB) *linetest.Bot {
+	t.Helper()
+	return linetest.StartBot(t, func(server *bot.Server) {
+		app.Register(server, cfg, db, app.WithWeatherProvider(weathertest.New()))
+	})
+}
+
+// sendText は source からテキストメッセージを送り、Botの返信を返す
+func sendText(t *testing.T, b *linetest.Bot, source *linebot.EventSource, text string) []json.RawMessage {
+	t.Helper()
+	n := len(b.API.Calls())
+	b.SendAndWait(t, n+1, linetest.TextEvent(source, text))
+	replies := b.API.Replies()
+	if len(replies) == 0 {
+		t.Fatalf("no reply to %q", text)
+	}
+	return replies[len(replies)-1].Messages
+}
+
+// message は送られたメッセージのうち、テストで確かめる項目
+type message struct {
+	Type    string `json:"type"`
+	Text    string `json:"text"`
+	AltText string `json:"altText"`
+}
+
+func decode(t *testing.T, messages []json.RawMessage) message {
+	t.Helper()
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	var m message
+	if err := json.Unmarshal(messages[0], &m); err != nil {
+		t.Fatalf("failed to decode message %s: %v", messages[0], err)
+	}
+	return m
+}
+
+func TestOmikuji(t *testing.T) {
+	b := startBot(t, config.Default(), nil)
+
+	m := decode(t, sendText(t, b, linetest.User("Uomikuji"), "おみくじ引きたい"))
+	if m.Type != "text" || !strings.HasSuffix(m.Text, "吉") && !strings.HasSuffix(m.Text, "凶") {
+		t.Errorf("got %+v, want an omikuji result", m)
+	}
+}
+
+func TestWeather(t *testing.T) {
+	b := startBot(t, config.Default(), nil)
+
+	m := decode(t, sendText(t, b, linetest.User("Uweather"), "天気 東京"))
+	if m.Type != "flex" || !strings.Contains(m.AltText, "東京") {
+		t.Errorf("got %+v, want a forecast for 東京", m)
+	}
+}
+
+// TestTodo はデータベースの設定 (DB_*) があるときだけ動かす
+func TestTodo(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(config.Database); err != nil {
+		t.Skipf("データベースの設定がないのでTodoListは確かめない: %v", err)
+	}
+	db, err := sqlx.Connect("mysql", cfg.DB.DSN())
+	if err != nil {
+		t.Skipf("データベースに接続できないのでTodoListは確かめない: %v", err)
+	}
+	defer db.Close()
+
+	source := linetest.User("Ulinetest-todo")
+	t.Cleanup(func() {
+		service, err := todo.New(context.Background(), db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		service.Forget(context.Background(), source)
+	})
+	b := startBot(t, cfg, db)
+
+	added := decode(t, sendText(t, b, source, `todo add "linetest のタスク" 明日 18:00`))
+	if !strings.HasPrefix(added.Text, "todo added") {
+		t.Fatalf("got %q, want the todo to be added", added.Text)
+	}
+	list := decode(t, sendText(t, b, source, "todo list"))
+	if !strings.Contains(list.Text, "linetest のタスク") {
+		t.Errorf("got %q, want the added todo in the list", list.Text)
+	}
+}
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"container/list"
+	"context"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// 重複して届いたために捨てたイベントの数
+// /debug/vars の "bot" の "duplicate_events_dropped" で確認できる
+var metrics = expvar.NewMap("bot")
+
+const duplicateEventsDropped = "duplicate_events_dropped"
+
+// EventStore は処理済みのイベントの webhookEventId を記録する
+// LINEサーバから同じイベントが再送されたときに、もう一度処理しないために使う
+type EventStore interface {
+	// Mark は id を処理済みとして記録する
+	// すでに記録されていたときは duplicate が true になる
+	Mark(ctx context.Context, id string) (duplicate bool, err error)
+	// Unmark は Mark した記録を取り消す
+	// 受け付けに失敗したイベントを再送で処理できるようにするために使う
+	Unmark(ctx context.Context, id string) error
+}
+
+// WithEventStore は処理済みのイベントを記録する場所を設定する
+// 初期値は最大1万件・24時間保持する MemoryEventStore
+func WithEventStore(store EventStore) Option {
+	return func(o *options) {
+		o.eventStore = store
+	}
+}
+
+// DuplicateEventsDropped は重複して届いたために捨てたイベントの数を返す
+func DuplicateEventsDropped() int64 {
+	if v, ok := metrics.Get(duplicateEventsDropped).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// MemoryEventStore はメモリ上に処理済みのイベントを記録する EventStore
+// 最大 capacity 件を保持し、それを超えたときや ttl を過ぎたときは古いものから忘れる
+type MemoryEventStore struct {
+	capacity int
+	ttl      time.Duration
+	// now は今の時刻を返す。テストで時刻を進めるときに差し替える
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order は新しく記録したものほど前に並ぶ
+	order *list.List
+}
+
+type memoryEntry struct {
+	id       string
+	markedAt time.Time
+}
+
+// NewMemoryEventStore は MemoryEventStore を作る
+func NewMemoryEventStore(capacity int, ttl time.Duration) *MemoryEventStore {
+	return &MemoryEventStore{
+		capacity: capacity,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Mark は id を処理済みとして記録する
+func (s *MemoryEventStore) Mark(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.expire(now)
+	if _, ok := s.entries[id]; ok {
+		return true, nil
+	}
+
+	s.entries[id] = s.order.PushFront(&memoryEntry{id: id, markedAt: now})
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+	return false, nil
+}
+
+// Unmark は Mark した記録を取り消す
+func (s *MemoryEventStore) Unmark(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[id]; ok {
+		s.remove(element)
+	}
+	return nil
+}
+
+// expire は ttl を過ぎた記録を古いものから消す
+func (s *MemoryEventStore) expire(now time.Time) {
+	for element := s.order.Back(); element != nil; element = s.order.Back() {
+		if now.Sub(element.Value.(*memoryEntry).markedAt) < s.ttl {
+			return
+		}
+		s.remove(element)
+	}
+}
+
+func (s *MemoryEventStore) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.entries, element.Value.(*memoryEntry).id)
+}
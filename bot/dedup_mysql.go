@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MySQLEventStore はMySQLデータベースに処理済みのイベントを記録する EventStore
+// サーバを再起動したり複数台で動かしたりしても重複を見つけられる
+type MySQLEventStore struct {
+	db  *sqlx.DB
+	ttl time.Duration
+
+	mu       sync.Mutex
+	purgedAt time.Time
+}
+
+// 処理済みのイベントを記録するテーブル
+const createWebhookEventsTable = `CREATE TABLE IF NOT EXISTS webhook_events (
+	webhook_event_id VARCHAR(64) NOT NULL PRIMARY KEY,
+	marked_at DATETIME NOT NULL,
+	INDEX (marked_at)
+)`
+
+// NewMySQLEventStore は MySQLEventStore を作る
+// 記録用のテーブルがなければ作成する。ttl を過ぎた記録はときどき削除する
+func NewMySQLEventStore(ctx context.Context, db *sqlx.DB, ttl time.Duration) (*MySQLEventStore, error) {
+	if _, err := db.ExecContext(ctx, createWebhookEventsTable); err != nil {
+		return nil, err
+	}
+	return &MySQLEventStore{db: db, ttl: ttl}, nil
+}
+
+// Mark は id を処理済みとして記録する
+func (s *MySQLEventStore) Mark(ctx context.Context, id string) (bool, error) {
+	s.purge(ctx)
+
+	// すでに同じIDが記録されていれば何も追加されない
+	result, err := s.db.ExecContext(ctx, "INSERT IGNORE INTO webhook_events (webhook_event_id, marked_at) VALUES (?, ?)", id, time.Now())
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 0, nil
+}
+
+// Unmark は Mark した記録を取り消す
+func (s *MySQLEventStore) Unmark(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM webhook_events WHERE webhook_event_id = ?", id)
+	return err
+}
+
+// purge は ttl を過ぎた記録を削除する
+// 毎回削除すると遅くなるので、1分に1回だけ行う
+func (s *MySQLEventStore) purge(ctx context.Context) {
+	s.mu.Lock()
+	now := time.Now()
+	if now.Sub(s.purgedAt) < time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.purgedAt = now
+	s.mu.Unlock()
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM webhook_events WHERE marked_at < ?", now.Add(-s.ttl)); err != nil {
+		log.Printf("failed to purge webhook events: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock は進めたときだけ時刻が変わる時計
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestEventStore(capacity int, ttl time.Duration) (*MemoryEventStore, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2023, 2, 24, 12, 0, 0, 0, time.UTC)}
+	store := NewMemoryEventStore(capacity, ttl)
+	store.now = clock.Now
+	return store, clock
+}
+
+// assertMark は id を Mark して、重複と判定されたかを確かめる
+func assertMark(t *testing.T, store *MemoryEventStore, id string, wantDuplicate bool) {
+	t.Helper()
+	duplicate, err := store.Mark(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if duplicate != wantDuplicate {
+		t.Errorf("Mark(%q): got duplicate %v, want %v", id, duplicate, wantDuplicate)
+	}
+}
+
+func TestMemoryEventStoreDetectsDuplicates(t *testing.T) {
+	store, _ := newTestEventStore(10, time.Hour)
+	assertMark(t, store, "a", false)
+	assertMark(t, store, "a", true)
+	assertMark(t, store, "b", false)
+
+	// 取り消したものは次に届いたときに処理する
+	if err := store.Unmark(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	assertMark(t, store, "a", false)
+}
+
+func TestMemoryEventStoreExpires(t *testing.T) {
+	store, clock := newTestEventStore(10, time.Hour)
+	assertMark(t, store, "a", false)
+	clock.Advance(30 * time.Minute)
+	assertMark(t, store, "b", false)
+
+	// ttl を過ぎた a だけ忘れる
+	clock.Advance(30 * time.Minute)
+	assertMark(t, store, "b", true)
+	assertMark(t, store, "a", false)
+}
+
+func TestMemoryEventStoreEvictsOldest(t *testing.T) {
+	store, clock := newTestEventStore(2, time.Hour)
+	for _, id := range []string{"a", "b", "c"} {
+		assertMark(t, store, id, false)
+		clock.Advance(time.Second)
+	}
+	// 上限を超えたので、いちばん古い a を忘れる
+	assertMark(t, store, "c", true)
+	assertMark(t, store, "b", true)
+	assertMark(t, store, "a", false)
+}
@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"context"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// FollowHandler は友だち追加(ブロック解除)されたときの処理
+type FollowHandler func(ctx context.Context, event *linebot.Event) linebot.SendingMessage
+
+// UnfollowHandler はブロックされたときの処理
+// 返信できないイベントなので送信元だけを受け取る
+type UnfollowHandler func(ctx context.Context, source *linebot.EventSource)
+
+// JoinHandler はグループ・トークルームに参加したときの処理
+type JoinHandler func(ctx context.Context, event *linebot.Event) linebot.SendingMessage
+
+// LeaveHandler はグループから退出させられたときの処理
+// 返信できないイベントなので送信元だけを受け取る
+type LeaveHandler func(ctx context.Context, source *linebot.EventSource)
+
+// MemberJoinedHandler はBotのいるグループ・トークルームにメンバーが参加したときの処理
+type MemberJoinedHandler func(ctx context.Context, event *linebot.Event, members []*linebot.EventSource) linebot.SendingMessage
+
+// MemberLeftHandler はBotのいるグループ・トークルームからメンバーが退出したときの処理
+// 返信できないイベントなので送信元と退出したメンバーだけを受け取る
+type MemberLeftHandler func(ctx context.Context, source *linebot.EventSource, members []*linebot.EventSource)
+
+// PostbackHandler はポストバックアクションが押されたときの処理
+type PostbackHandler func(ctx context.Context, event *linebot.Event, postback *linebot.Postback) linebot.SendingMessage
+
+// BeaconHandler はビーコンの電波を受信したときの処理
+type BeaconHandler func(ctx context.Context, event *linebot.Event, beacon *linebot.Beacon) linebot.SendingMessage
+
+// UnsendHandler はメッセージの送信が取り消されたときの処理
+// 返信できないイベントなので送信元と取り消されたメッセージだけを受け取る
+type UnsendHandler func(ctx context.Context, source *linebot.EventSource, unsend *linebot.Unsend)
+
+// VideoPlayCompleteHandler は送った動画が最後まで視聴されたときの処理
+type VideoPlayCompleteHandler func(ctx context.Context, event *linebot.Event, videoPlayComplete *linebot.VideoPlayComplete) linebot.SendingMessage
+
+// イベントの種類ごとに登録された処理
+type handlers struct {
+	message           MessageHandler
+	follow            FollowHandler
+	unfollow          UnfollowHandler
+	join              JoinHandler
+	leave             LeaveHandler
+	memberJoined      MemberJoinedHandler
+	memberLeft        MemberLeftHandler
+	postback          PostbackHandler
+	beacon            BeaconHandler
+	unsend            UnsendHandler
+	videoPlayComplete VideoPlayCompleteHandler
+}
+
+// HandleMessage はメッセージが来たときの処理を登録する
+func (s *Server) HandleMessage(handler MessageHandler) {
+	s.handlers.message = handler
+}
+
+// HandleFollow は友だち追加されたときの処理を登録する
+func (s *Server) HandleFollow(handler FollowHandler) {
+	s.handlers.follow = handler
+}
+
+// HandleUnfollow はブロックされたときの処理を登録する
+func (s *Server) HandleUnfollow(handler UnfollowHandler) {
+	s.handlers.unfollow = handler
+}
+
+// HandleJoin はグループ・トークルームに参加したときの処理を登録する
+func (s *Server) HandleJoin(handler JoinHandler) {
+	s.handlers.join = handler
+}
+
+// HandleLeave はグループから退出させられたときの処理を登録する
+func (s *Server) HandleLeave(handler LeaveHandler) {
+	s.handlers.leave = handler
+}
+
+// HandleMemberJoined はメンバーが参加したときの処理を登録する
+func (s *Server) HandleMemberJoined(handler MemberJoinedHandler) {
+	s.handlers.memberJoined = handler
+}
+
+// HandleMemberLeft はメンバーが退出したときの処理を登録する
+func (s *Server) HandleMemberLeft(handler MemberLeftHandler) {
+	s.handlers.memberLeft = handler
+}
+
+// HandlePostback はポストバックアクションが押されたときの処理を登録する
+func (s *Server) HandlePostback(handler PostbackHandler) {
+	s.handlers.postback = handler
+}
+
+// HandleBeacon はビーコンの電波を受信したときの処理を登録する
+func (s *Server) HandleBeacon(handler BeaconHandler) {
+	s.handlers.beacon = handler
+}
+
+// HandleUnsend はメッセージの送信が取り消されたときの処理を登録する
+func (s *Server) HandleUnsend(handler UnsendHandler) {
+	s.handlers.unsend = handler
+}
+
+// HandleVideoPlayComplete は動画が最後まで視聴されたときの処理を登録する
+func (s *Server) HandleVideoPlayComplete(handler VideoPlayCompleteHandler) {
+	s.handlers.videoPlayComplete = handler
+}
+
+// Dispatch はイベントの種類に応じて登録された処理を呼び出し、返信を返す
+// 処理が登録されていないイベントや返信できないイベントでは nil を返す
+func (s *Server) Dispatch(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	h := s.handlers
+	switch event.Type {
+	// メッセージが来たとき
+	case linebot.EventTypeMessage:
+		if h.message != nil {
+			return h.message(ctx, event)
+		}
+	// 友だち追加されたとき
+	case linebot.EventTypeFollow:
+		if h.follow != nil {
+			return h.follow(ctx, event)
+		}
+	// ブロックされたとき
+	case linebot.EventTypeUnfollow:
+		if h.unfollow != nil {
+			h.unfollow(ctx, event.Source)
+		}
+	// グループ・トークルームに参加したとき
+	case linebot.EventTypeJoin:
+		if h.join != nil {
+			return h.join(ctx, event)
+		}
+	// グループから退出させられたとき
+	case linebot.EventTypeLeave:
+		if h.leave != nil {
+			h.leave(ctx, event.Source)
+		}
+	// メンバーが参加したとき
+	case linebot.EventTypeMemberJoined:
+		if h.memberJoined != nil {
+			return h.memberJoined(ctx, event, event.Members)
+		}
+	// メンバーが退出したとき
+	case linebot.EventTypeMemberLeft:
+		if h.memberLeft != nil {
+			h.memberLeft(ctx, event.Source, event.Members)
+		}
+	// ポストバックアクションが押されたとき
+	case linebot.EventTypePostback:
+		if h.postback != nil && event.Postback != nil {
+			return h.postback(ctx, event, event.Postback)
+		}
+	// ビーコンの電波を受信したとき
+	case linebot.EventTypeBeacon:
+		if h.beacon != nil && event.Beacon != nil {
+			return h.beacon(ctx, event, event.Beacon)
+		}
+	// メッセージの送信が取り消されたとき
+	case linebot.EventTypeUnsend:
+		if h.unsend != nil && event.Unsend != nil {
+			h.unsend(ctx, event.Source, event.Unsend)
+		}
+	// 動画が最後まで視聴されたとき
+	case linebot.EventTypeVideoPlayComplete:
+		if h.videoPlayComplete != nil && event.VideoPlayComplete != nil {
+			return h.videoPlayComplete(ctx, event, event.VideoPlayComplete)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ReadinessCheck はサーバがリクエストを受け付けられる状態かを確認する関数
+// 受け付けられないときはその理由をエラーで返す
+type ReadinessCheck func(ctx context.Context) error
+
+type readinessCheck struct {
+	name  string
+	check ReadinessCheck
+}
+
+// readiness は /readyz で確認する項目をまとめたもの
+type readiness struct {
+	checks []readinessCheck
+	// shuttingDown は Shutdown が始まったら 1 になる
+	shuttingDown int32
+}
+
+// AddReadinessCheck は /readyz で確認する項目を追加する
+// データベースへの接続や設定が正しいかの確認などに使う
+func (s *Server) AddReadinessCheck(name string, check ReadinessCheck) {
+	s.readiness.checks = append(s.readiness.checks, readinessCheck{name: name, check: check})
+}
+
+// handleHealthz はプロセスが動いていれば常に 200 を返す
+func (s *Server) handleHealthz(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz は確認する項目がすべて問題なければ 200 を、そうでなければ 503 と理由を返す
+// 終了処理が始まった後は新しいリクエストを送られないように常に 503 を返す
+func (s *Server) handleReadyz(w http.ResponseWriter, req *http.Request) {
+	if atomic.LoadInt32(&s.readiness.shuttingDown) == 1 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "shutting down")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+	defer cancel()
+
+	var failures []string
+	for _, c := range s.readiness.checks {
+		if err := c.check(ctx); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", c.name, err))
+		}
+	}
+	if len(failures) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, failure := range failures {
+			fmt.Fprintln(w, failure)
+		}
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
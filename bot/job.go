@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// Job はイベントとは関係なく、裏側で動かし続ける処理
+// ctx はサーバが終了するときに cancel されるので、そうしたら戻る
+type Job func(ctx context.Context)
+
+// Pusher はプッシュメッセージを送る
+// *linebot.Client がそのまま使えるので、Job の中でイベントを待たずにメッセージを送るときに使う
+type Pusher interface {
+	PushMessage(to string, messages ...linebot.SendingMessage) *linebot.PushMessageCall
+}
+
+// LateWindow は決まった時刻にプッシュメッセージを送る処理が、その時刻からどれだけ遅れても送るか
+// サーバが止まっていて時刻を過ぎたときも、この間に起動すれば送る
+const LateWindow = time.Hour
+
+// Go は job をサーバが終了するまで裏側で動かす
+// 決まった時間にプッシュメッセージを送るときなどに使う
+func (s *Server) Go(job Job) {
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		job(s.jobCtx)
+	}()
+}
+
+// Every は interval ごとに job を呼び出す Job を作る
+// 呼び出しには呼び出した時刻を渡す
+func Every(interval time.Duration, job func(ctx context.Context, now time.Time)) Job {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				job(ctx, now)
+			}
+		}
+	}
+}
+
+// stopJobs は Go で動かしている処理を止め、すべて戻るまで待つ
+func (s *Server) stopJobs(ctx context.Context) error {
+	s.stopJob()
+	done := make(chan struct{})
+	go func() {
+		s.jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		log.Println("裏側の処理が終わるのを待たずに終了します")
+		return ctx.Err()
+	}
+}
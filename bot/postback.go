@@ -0,0 +1,55 @@
+package bot
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// PostbackRouter はポストバックのデータの action によって処理を振り分ける
+//
+// データは "action=weather&lat=35.68&lon=139.76" のようにクエリ文字列の形にする。
+// Server.HandlePostback には1つの処理しか登録できないので、
+// いくつもの機能がポストバックを使うときはこれを登録する
+type PostbackRouter struct {
+	handlers map[string]PostbackHandler
+	fallback PostbackHandler
+}
+
+// NewPostbackRouter は空の PostbackRouter を作る
+func NewPostbackRouter() *PostbackRouter {
+	return &PostbackRouter{handlers: map[string]PostbackHandler{}}
+}
+
+// Handle は action のポストバックの処理を登録する
+func (r *PostbackRouter) Handle(action string, handler PostbackHandler) {
+	r.handlers[action] = handler
+}
+
+// Fallback はどの action にも当てはまらなかったときの処理を登録する
+func (r *PostbackRouter) Fallback(handler PostbackHandler) {
+	r.fallback = handler
+}
+
+// HandlePostback は action に合った処理を呼び出す
+// Server.HandlePostback にそのまま渡せる
+func (r *PostbackRouter) HandlePostback(ctx context.Context, event *linebot.Event, postback *linebot.Postback) linebot.SendingMessage {
+	if handler, ok := r.handlers[PostbackData(postback).Get("action")]; ok {
+		return handler(ctx, event, postback)
+	}
+	if r.fallback == nil {
+		return nil
+	}
+	return r.fallback(ctx, event, postback)
+}
+
+// PostbackData はポストバックのデータをクエリ文字列として読み取る
+// 読み取れないときは空の url.Values を返す
+func PostbackData(postback *linebot.Postback) url.Values {
+	values, err := url.ParseQuery(postback.Data)
+	if err != nil {
+		return url.Values{}
+	}
+	return values
+}
@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// Matcher はメッセージイベントがコマンドに当てはまるかを判定する関数
+type Matcher func(event *linebot.Event) bool
+
+// Router は登録されたコマンドの中から当てはまるものを選んで返信を生成する
+// 優先度(priority)が大きいコマンドから順に判定し、同じ優先度なら登録した順に判定する
+type Router struct {
+	routes   []route
+	fallback MessageHandler
+}
+
+type route struct {
+	priority int
+	matcher  Matcher
+	handler  MessageHandler
+}
+
+// NewRouter は空の Router を作る
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle はコマンドを登録する
+func (r *Router) Handle(priority int, matcher Matcher, handler MessageHandler) {
+	r.routes = append(r.routes, route{
+		priority: priority,
+		matcher:  matcher,
+		handler:  handler,
+	})
+	// 登録順を保ったまま優先度の高い順に並べ替える
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return r.routes[i].priority > r.routes[j].priority
+	})
+}
+
+// Fallback はどのコマンドにも当てはまらなかったときの処理を登録する
+func (r *Router) Fallback(handler MessageHandler) {
+	r.fallback = handler
+}
+
+// HandleMessage は当てはまったコマンドの処理を呼び出す
+// Server.HandleMessage にそのまま渡せる
+func (r *Router) HandleMessage(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	for _, route := range r.routes {
+		if route.matcher(event) {
+			return route.handler(ctx, event)
+		}
+	}
+	if r.fallback == nil {
+		return nil
+	}
+	return r.fallback(ctx, event)
+}
+
+// Text はテキストメッセージの本文を取り出す
+// テキストメッセージでなければ ok は false になる
+func Text(event *linebot.Event) (text string, ok bool) {
+	message, ok := event.Message.(*linebot.TextMessage)
+	if !ok {
+		return "", false
+	}
+	return message.Text, true
+}
+
+// Prefix はテキストが prefix で始まるときに当てはまる
+func Prefix(prefix string) Matcher {
+	return func(event *linebot.Event) bool {
+		text, ok := Text(event)
+		return ok && strings.HasPrefix(text, prefix)
+	}
+}
+
+// Word はテキストの最初の単語が word と一致するときに当てはまる
+// 単語は空白(全角スペースを含む)で区切る
+func Word(word string) Matcher {
+	return func(event *linebot.Event) bool {
+		text, ok := Text(event)
+		if !ok {
+			return false
+		}
+		fields := strings.Fields(text)
+		return len(fields) > 0 && fields[0] == word
+	}
+}
+
+// Regexp はテキストが正規表現 re に当てはまるときに当てはまる
+func Regexp(re *regexp.Regexp) Matcher {
+	return func(event *linebot.Event) bool {
+		text, ok := Text(event)
+		return ok && re.MatchString(text)
+	}
+}
+
+// MessageType はメッセージの種類が messageType のときに当てはまる
+func MessageType(messageType linebot.MessageType) Matcher {
+	return func(event *linebot.Event) bool {
+		return messageTypeOf(event.Message) == messageType
+	}
+}
+
+// Webhookから組み立てたメッセージは Type() が空になるので、型から種類を判定する
+func messageTypeOf(message linebot.Message) linebot.MessageType {
+	switch message.(type) {
+	case *linebot.TextMessage:
+		return linebot.MessageTypeText
+	case *linebot.ImageMessage:
+		return linebot.MessageTypeImage
+	case *linebot.VideoMessage:
+		return linebot.MessageTypeVideo
+	case *linebot.AudioMessage:
+		return linebot.MessageTypeAudio
+	case *linebot.FileMessage:
+		return linebot.MessageTypeFile
+	case *linebot.LocationMessage:
+		return linebot.MessageTypeLocation
+	case *linebot.StickerMessage:
+		return linebot.MessageTypeSticker
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,77 @@
+package bot_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+)
+
+// reply は name を返信する MessageHandler
+func reply(name string) bot.MessageHandler {
+	return func(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+		return linebot.NewTextMessage(name)
+	}
+}
+
+func textEvent(text string) *linebot.Event {
+	return &linebot.Event{Type: linebot.EventTypeMessage, Message: &linebot.TextMessage{Text: text}}
+}
+
+// route は router がどの処理を選んだかを返す。何も返信しなかったときは空文字列
+func route(router *bot.Router, event *linebot.Event) string {
+	message, ok := router.HandleMessage(context.Background(), event).(*linebot.TextMessage)
+	if !ok {
+		return ""
+	}
+	return message.Text
+}
+
+func TestRouterPriority(t *testing.T) {
+	router := bot.NewRouter()
+	router.Handle(0, bot.Regexp(regexp.MustCompile("おみくじ")), reply("omikuji"))
+	router.Handle(10, bot.Word("todo"), reply("todo"))
+	router.Handle(0, bot.Prefix("todo"), reply("todo-prefix"))
+	router.Handle(0, bot.Regexp(regexp.MustCompile("おみくじ")), reply("omikuji-second"))
+	router.Handle(0, bot.MessageType(linebot.MessageTypeSticker), reply("sticker"))
+	router.Fallback(reply("fallback"))
+
+	tests := []struct {
+		name  string
+		event *linebot.Event
+		want  string
+	}{
+		// 後から登録しても、優先度の大きいものを先に判定する
+		{"priority", textEvent("todo add おみくじを引く 明日"), "todo"},
+		// 同じ優先度なら登録した順に判定する
+		{"registration order", textEvent("おみくじ引きたい"), "omikuji"},
+		{"same priority", textEvent("todolist"), "todo-prefix"},
+		// 全角スペースも単語の区切り
+		{"full-width space", textEvent("todo　list"), "todo"},
+		{"message type", &linebot.Event{Type: linebot.EventTypeMessage, Message: &linebot.StickerMessage{}}, "sticker"},
+		// どれにも当てはまらなければ Fallback
+		{"fallback", textEvent("こんにちは"), "fallback"},
+		{"fallback for other types", &linebot.Event{Type: linebot.EventTypeMessage, Message: &linebot.ImageMessage{}}, "fallback"},
+	}
+	for _, tt := range tests {
+		if got := route(router, tt.event); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRouterWithoutFallback(t *testing.T) {
+	router := bot.NewRouter()
+	router.Handle(0, bot.Word("ヘルプ"), reply("help"))
+
+	if got := route(router, textEvent("ヘルプ")); got != "help" {
+		t.Errorf("got %q, want %q", got, "help")
+	}
+	// Fallback がなければ返信しない
+	if got := router.HandleMessage(context.Background(), textEvent("こんにちは")); got != nil {
+		t.Errorf("got %v, want no reply", got)
+	}
+}
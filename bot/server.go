@@ -0,0 +1,291 @@
+// Package bot はLINE Botのサーバに共通する処理をまとめたパッケージ
+// 各ステップはこのパッケージの Server に返信の作り方を登録するだけでよい
+package bot
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// MessageHandler はメッセージイベントを受け取って返信を生成する関数
+// nil を返したときは返信しない
+type MessageHandler func(ctx context.Context, event *linebot.Event) linebot.SendingMessage
+
+// Server はLINEのAPIクライアントとHTTPの受け口をまとめて持つ
+// /callback に届いたイベントはすぐに受け付けて 200 を返し、裏側のワーカーで順番に処理する
+type Server struct {
+	// LINEのAPIを利用するためのクライアント
+	Client *linebot.Client
+
+	mux      *http.ServeMux
+	handlers handlers
+	pool     *workerPool
+	events   EventStore
+
+	httpServer      *http.Server
+	readiness       readiness
+	shutdownTimeout time.Duration
+
+	// ctx はイベントの処理に渡す context で、Shutdown が間に合わなかったときに cancel される
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// jobCtx は Go で動かす処理に渡す context で、Shutdown が始まったときに cancel される
+	jobCtx  context.Context
+	stopJob context.CancelFunc
+	jobs    sync.WaitGroup
+}
+
+// Option は Server の設定を変える
+type Option func(*options)
+
+type options struct {
+	clientOptions   []linebot.ClientOption
+	workers         int
+	queueSize       int
+	enqueueTimeout  time.Duration
+	eventStore      EventStore
+	shutdownTimeout time.Duration
+}
+
+// WithClientOptions はLINEのAPIクライアントの設定を追加する
+func WithClientOptions(clientOptions ...linebot.ClientOption) Option {
+	return func(o *options) {
+		o.clientOptions = append(o.clientOptions, clientOptions...)
+	}
+}
+
+// WithEndpointBase はMessaging APIの呼び出し先を endpointBase に変える
+// 空のときは本物のLINEのAPIを使う
+func WithEndpointBase(endpointBase string) Option {
+	return func(o *options) {
+		if endpointBase != "" {
+			o.clientOptions = append(o.clientOptions, linebot.WithEndpointBase(endpointBase))
+		}
+	}
+}
+
+// WithWorkers はイベントを同時に処理するワーカーの数を設定する (初期値は 4)
+func WithWorkers(n int) Option {
+	return func(o *options) {
+		o.workers = n
+	}
+}
+
+// WithQueueSize はワーカー1つあたりに順番待ちできるイベントの数を設定する (初期値は 64)
+func WithQueueSize(n int) Option {
+	return func(o *options) {
+		o.queueSize = n
+	}
+}
+
+// WithEnqueueTimeout はキューが一杯のときに空くのを待つ時間を設定する (初期値は 1秒)
+// 待っても空かなければ /callback は 503 を返し、LINEサーバに再送してもらう
+func WithEnqueueTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.enqueueTimeout = d
+	}
+}
+
+// WithShutdownTimeout は Run が終了のシグナルを受け取ってから
+// 処理中のイベントを待つ時間の上限を設定する (初期値は 30秒)
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.shutdownTimeout = d
+	}
+}
+
+// New はLINEのAPIを利用する設定をしたサーバを作る
+func New(channelSecret, channelAccessToken string, opts ...Option) (*Server, error) {
+	o := options{
+		workers:         4,
+		queueSize:       64,
+		enqueueTimeout:  time.Second,
+		eventStore:      NewMemoryEventStore(10000, 24*time.Hour),
+		shutdownTimeout: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	client, err := linebot.New(channelSecret, channelAccessToken, o.clientOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Client: client,
+		mux:    http.NewServeMux(),
+		events: o.eventStore,
+		httpServer: &http.Server{
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      10 * time.Second,
+			IdleTimeout:       60 * time.Second,
+		},
+		shutdownTimeout: o.shutdownTimeout,
+	}
+	s.httpServer.Handler = s
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.jobCtx, s.stopJob = context.WithCancel(context.Background())
+	s.pool = newWorkerPool(o.workers, o.queueSize, o.enqueueTimeout, func(event *linebot.Event) {
+		s.handleEvent(s.ctx, event)
+	})
+	// LINEサーバからのリクエストを受け取ったときの処理
+	s.mux.HandleFunc("/callback", s.handleCallback)
+	// 重複して捨てたイベントの数などを確認できるようにする
+	s.mux.Handle("/debug/vars", expvar.Handler())
+	// プロセスが動いているか・リクエストを受け付けられるかを外から確認できるようにする
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.HandleFunc("/readyz", s.handleReadyz)
+	return s, nil
+}
+
+// Handle は /callback 以外のパスに処理を追加する
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP はリクエストを登録されたパスの処理に振り分ける
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mux.ServeHTTP(w, req)
+}
+
+// ListenAndServe はLINEサーバからのリクエストを受け取るプロセスを起動する
+// Shutdown が呼ばれると http.ErrServerClosed を返す
+func (s *Server) ListenAndServe(addr string) error {
+	s.httpServer.Addr = addr
+	return s.httpServer.ListenAndServe()
+}
+
+// Run はリクエストを受け取るプロセスを起動し、SIGINT か SIGTERM を受け取ったら終了処理をする
+// 終了処理では新しいリクエストの受け付けをやめ、受け付け済みのイベントを処理し終わるまで待つ
+func (s *Server) Run(addr string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.ListenAndServe(addr)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("サーバを終了します")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
+
+// Shutdown は新しいリクエストの受け付けをやめ、受け付け済みのイベントをすべて処理し終わるまで待つ
+// Go で動かしている処理も止めて、戻るまで待つ
+// ctx が先に終わったときは処理中のイベントの context を cancel して ctx.Err() を返す
+// 途中で失敗しても残りの片付けは必ず行う。起きたエラーはすべてログに残し、そのうち1つを返す
+func (s *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&s.readiness.shuttingDown, 1)
+	defer s.cancel()
+	jobsErr := s.stopJobs(ctx)
+
+	// 先に /callback の受け付けをやめてから、キューに残ったイベントを処理する
+	httpErr := s.httpServer.Shutdown(ctx)
+	drainErr := s.pool.drain(ctx)
+	return shutdownError(ctx, jobsErr, httpErr, drainErr)
+}
+
+// shutdownError は終了処理で起きたエラーをログに残し、呼び出し元に返すエラーを選ぶ
+// ctx が先に終わったときは、errors.Is(err, context.DeadlineExceeded) で判定できるように ctx.Err() をそのまま返す
+// それ以外は最初に起きたエラーを返す
+func shutdownError(ctx context.Context, errs ...error) error {
+	var first error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		log.Printf("終了処理でエラーが発生しました: %v", err)
+		if first == nil {
+			first = err
+		}
+	}
+	if first != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return first
+}
+
+func (s *Server) handleCallback(w http.ResponseWriter, req *http.Request) {
+	log.Println("Accessed")
+
+	// リクエストを扱いやすい形に変換する
+	events, err := s.Client.ParseRequest(req)
+	if err != nil {
+		if err == linebot.ErrInvalidSignature {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// イベントをキューに入れて、処理を待たずにLINEサーバへ返事をする
+	for _, event := range events {
+		// 再送されてきたイベントがすでに処理済みなら捨てる
+		duplicate, err := s.markEvent(req.Context(), event)
+		if err != nil {
+			log.Printf("failed to check webhook event %s: %v", event.WebhookEventID, err)
+		}
+		if duplicate {
+			metrics.Add(duplicateEventsDropped, 1)
+			log.Printf("dropped duplicate webhook event %s (redelivery: %v)", event.WebhookEventID, event.DeliveryContext.IsRedelivery)
+			continue
+		}
+
+		if err := s.pool.enqueue(req.Context(), event); err != nil {
+			log.Printf("failed to enqueue event: %v", err)
+			// 再送されたときに処理できるように記録を取り消す
+			if event.WebhookEventID != "" {
+				if err := s.events.Unmark(req.Context(), event.WebhookEventID); err != nil {
+					log.Printf("failed to unmark webhook event %s: %v", event.WebhookEventID, err)
+				}
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// markEvent はイベントを処理済みとして記録し、すでに処理済みだったかを返す
+// webhookEventId のないイベントは重複を判定できないので、常に未処理として扱う
+// 記録に失敗したときも、イベントを取りこぼさないように未処理として扱う
+func (s *Server) markEvent(ctx context.Context, event *linebot.Event) (bool, error) {
+	if event.WebhookEventID == "" {
+		return false, nil
+	}
+	return s.events.Mark(ctx, event.WebhookEventID)
+}
+
+func (s *Server) handleEvent(ctx context.Context, event *linebot.Event) {
+	// 返信を生成する
+	replyMessage := s.Dispatch(ctx, event)
+	if replyMessage == nil {
+		return
+	}
+	// 生成した返信を送信する
+	if _, err := s.Client.ReplyMessage(event.ReplyToken, replyMessage).WithContext(ctx).Do(); err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,122 @@
+package bot_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+	"github.com/xxarupakaxx/sysad-linebot-handson/linetest"
+)
+
+// 裏側の処理が止まらずに待ちきれなかったときも、HTTPサーバとイベントの受け付けは止める
+func TestShutdownStopsEverythingWhenJobsTimeOut(t *testing.T) {
+	server, err := bot.New(linetest.ChannelSecret, "linetest-channel-access-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stuck := make(chan struct{})
+	defer close(stuck)
+	// ctx が cancel されても戻らない処理
+	server.Go(func(ctx context.Context) { <-stuck })
+
+	served := make(chan error, 1)
+	go func() { served <- server.ListenAndServe("127.0.0.1:0") }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+
+	select {
+	case err := <-served:
+		if !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("ListenAndServe returned %v, want http.ErrServerClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("HTTP server is still running after Shutdown")
+	}
+
+	// キューを閉じたので、新しいイベントは受け付けない
+	req, err := linetest.NewRequest(context.Background(), "/callback", linetest.ChannelSecret, linetest.TextEvent(linetest.User("Ushutdown"), "おみくじ"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d after Shutdown, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+// キューが一杯で待ちきれなかったときは 503 を返して、LINEサーバに再送してもらう
+func TestCallbackReturnsServiceUnavailableWhenQueueIsFull(t *testing.T) {
+	server, err := bot.New(linetest.ChannelSecret, "linetest-channel-access-token",
+		bot.WithWorkers(1), bot.WithQueueSize(1), bot.WithEnqueueTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	defer close(release)
+	server.HandleMessage(func(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+
+	source := linetest.User("Ubusy")
+	send := func() int {
+		t.Helper()
+		req, err := linetest.NewRequest(context.Background(), "/callback", linetest.ChannelSecret, linetest.TextEvent(source, "こんにちは"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// 1つ目はワーカーが処理中で、2つ目はキューで待つ
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	<-started
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	if code := send(); code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d with a full queue, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+// LINEサーバから再送されたイベントは、すでに処理していれば捨てる
+func TestRedeliveredEventsAreSkipped(t *testing.T) {
+	b := linetest.StartBot(t, func(server *bot.Server) {
+		server.HandleMessage(func(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+			return linebot.NewTextMessage(event.Message.(*linebot.TextMessage).Text)
+		})
+	})
+	dropped := bot.DuplicateEventsDropped()
+
+	source := linetest.User("Uredelivery")
+	first := linetest.TextEvent(source, "1回目")
+	b.SendAndWait(t, 1, first)
+	// 同じイベントの再送と、新しいイベント
+	b.SendAndWait(t, 2, first.Redelivered(), linetest.TextEvent(source, "2回目"))
+
+	replies := b.API.Replies()
+	if len(replies) != 2 {
+		t.Fatalf("got %d replies, want 2", len(replies))
+	}
+	linetest.AssertMessages(t, replies[1].Messages, linebot.NewTextMessage("2回目"))
+	if got := bot.DuplicateEventsDropped() - dropped; got != 1 {
+		t.Errorf("got %d dropped events, want 1", got)
+	}
+}
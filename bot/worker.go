@@ -0,0 +1,141 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// ErrQueueFull はキューが空かずにイベントを受け付けられなかったときのエラー
+var ErrQueueFull = errors.New("bot: event queue is full")
+
+// ErrServerClosed は Shutdown の後にイベントを受け付けようとしたときのエラー
+var ErrServerClosed = errors.New("bot: server closed")
+
+// workerPool はイベントを順番待ちさせて複数のワーカーで処理する
+// 同じ送信元のイベントは必ず同じワーカーに渡るので、送られた順に処理される
+type workerPool struct {
+	queues  []chan *linebot.Event
+	timeout time.Duration
+	handle  func(event *linebot.Event)
+
+	// mu は queues を閉じる処理とイベントの追加がぶつからないようにする
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func newWorkerPool(workers, queueSize int, timeout time.Duration, handle func(event *linebot.Event)) *workerPool {
+	p := &workerPool{
+		queues:  make([]chan *linebot.Event, workers),
+		timeout: timeout,
+		handle:  handle,
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan *linebot.Event, queueSize)
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+// work はキューに入ったイベントを1つずつ処理する
+func (p *workerPool) work(queue <-chan *linebot.Event) {
+	defer p.wg.Done()
+	for event := range queue {
+		p.process(event)
+	}
+}
+
+// process はイベントを1つ処理する
+// 処理中に panic してもワーカーが止まらないようにする
+func (p *workerPool) process(event *linebot.Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("panic while handling %s event: %v\n%s", event.Type, r, debug.Stack())
+		}
+	}()
+	p.handle(event)
+}
+
+// enqueue はイベントを送信元に対応するキューに入れる
+// キューが一杯のときは空くまで timeout だけ待ち、それでも空かなければ ErrQueueFull を返す
+func (p *workerPool) enqueue(ctx context.Context, event *linebot.Event) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrServerClosed
+	}
+
+	queue := p.queues[p.index(event)]
+	select {
+	case queue <- event:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	select {
+	case queue <- event:
+		return nil
+	case <-timer.C:
+		return ErrQueueFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// index は送信元からイベントを担当するワーカーを決める
+func (p *workerPool) index(event *linebot.Event) int {
+	h := fnv.New32a()
+	h.Write([]byte(SourceID(event.Source)))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// drain は新しいイベントの受け付けをやめ、キューに残ったイベントをすべて処理し終わるまで待つ
+// ctx が先に終わったときは ctx.Err() を返す
+func (p *workerPool) drain(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		for _, queue := range p.queues {
+			close(queue)
+		}
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SourceID はイベントの送信元のIDを返す
+// グループ・トークルームからのイベントではグループ・トークルームのIDを返す
+func SourceID(source *linebot.EventSource) string {
+	if source == nil {
+		return ""
+	}
+	switch source.Type {
+	case linebot.EventSourceTypeGroup:
+		return source.GroupID
+	case linebot.EventSourceTypeRoom:
+		return source.RoomID
+	default:
+		return source.UserID
+	}
+}
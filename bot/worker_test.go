@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// newEvent は userID から送られたイベントを作る。id で見分けられるように WebhookEventID に入れる
+func newEvent(userID, id string) *linebot.Event {
+	return &linebot.Event{
+		Type:           linebot.EventTypeMessage,
+		Source:         &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: userID},
+		WebhookEventID: id,
+	}
+}
+
+// blockingHandler は release が閉じられるまでイベントの処理を止める
+type blockingHandler struct {
+	started chan string
+	release chan struct{}
+
+	mu      sync.Mutex
+	handled []string
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{started: make(chan string, 100), release: make(chan struct{})}
+}
+
+func (h *blockingHandler) handle(event *linebot.Event) {
+	h.started <- event.WebhookEventID
+	<-h.release
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handled = append(h.handled, event.WebhookEventID)
+}
+
+func (h *blockingHandler) Handled() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.handled...)
+}
+
+func TestWorkerPoolKeepsOrderPerSource(t *testing.T) {
+	var mu sync.Mutex
+	got := map[string][]int{}
+	pool := newWorkerPool(4, 100, time.Second, func(event *linebot.Event) {
+		var n int
+		fmt.Sscanf(event.WebhookEventID, "%d", &n)
+		// 処理にかかる時間をばらつかせても、同じ送信元の順番は変わらない
+		time.Sleep(time.Duration(n%3) * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		got[event.Source.UserID] = append(got[event.Source.UserID], n)
+	})
+
+	users := []string{"Ualice", "Ubob", "Ucarol", "Udave", "Ueve"}
+	for i := 0; i < 20; i++ {
+		for _, user := range users {
+			if err := pool.enqueue(context.Background(), newEvent(user, fmt.Sprint(i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := pool.drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range users {
+		if len(got[user]) != 20 {
+			t.Fatalf("%s: got %d events, want 20", user, len(got[user]))
+		}
+		for i, n := range got[user] {
+			if n != i {
+				t.Errorf("%s: got events in order %v", user, got[user])
+				break
+			}
+		}
+	}
+}
+
+func TestWorkerPoolReportsFullQueue(t *testing.T) {
+	h := newBlockingHandler()
+	defer close(h.release)
+	pool := newWorkerPool(1, 1, 10*time.Millisecond, h.handle)
+
+	// 1つ目はワーカーが処理中で、2つ目はキューで待つ
+	if err := pool.enqueue(context.Background(), newEvent("Uuser", "1")); err != nil {
+		t.Fatal(err)
+	}
+	<-h.started
+	if err := pool.enqueue(context.Background(), newEvent("Uuser", "2")); err != nil {
+		t.Fatal(err)
+	}
+	// キューが空かないので、待ちきれずに ErrQueueFull になる
+	if err := pool.enqueue(context.Background(), newEvent("Uuser", "3")); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("got %v, want ErrQueueFull", err)
+	}
+}
+
+func TestWorkerPoolDrainsQueuedEvents(t *testing.T) {
+	h := newBlockingHandler()
+	pool := newWorkerPool(1, 10, time.Second, h.handle)
+	for _, id := range []string{"1", "2", "3"} {
+		if err := pool.enqueue(context.Background(), newEvent("Uuser", id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-h.started
+
+	drained := make(chan error, 1)
+	go func() { drained <- pool.drain(context.Background()) }()
+	select {
+	case err := <-drained:
+		t.Fatalf("drain returned %v before the queued events were handled", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	// 閉じた後は新しいイベントを受け付けない
+	if err := pool.enqueue(context.Background(), newEvent("Uuser", "4")); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("got %v after drain, want ErrServerClosed", err)
+	}
+
+	close(h.release)
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+	if handled := h.Handled(); len(handled) != 3 {
+		t.Errorf("got %v handled, want all 3 queued events", handled)
+	}
+}
+
+func TestWorkerPoolDrainTimesOut(t *testing.T) {
+	h := newBlockingHandler()
+	defer close(h.release)
+	pool := newWorkerPool(1, 10, time.Second, h.handle)
+	if err := pool.enqueue(context.Background(), newEvent("Uuser", "1")); err != nil {
+		t.Fatal(err)
+	}
+	<-h.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const usage = `コマンド:
+	(テキスト)                          テキストメッセージを送る
+	/sticker <パッケージID> <スタンプID>   スタンプを送る
+	/location <緯度> <経度> [名前]        位置情報を送る
+	/postback <データ>                  ポストバックアクションを押す
+	/follow, /unfollow                 友だち追加・ブロックする
+	/join, /leave                      グループに招待する・グループから退出させる
+	/user <ID>                         ユーザーとの1対1のトークにする
+	/group <ID>                        グループのトークにする
+	/json                              JSON表示を切り替える
+	/help                              この使い方を表示する
+	/quit                              終了する`
+
+// parse は入力された1行をイベントにする
+// イベントを作らないコマンドでは event が nil になる
+func (s *session) parse(line string) (event *linebot.Event, quit bool, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, false, nil
+	}
+	// スラッシュで始まらなければテキストメッセージ
+	if !strings.HasPrefix(line, "/") {
+		return s.newEvent(linebot.EventTypeMessage, func(e *linebot.Event) {
+			e.Message = &linebot.TextMessage{ID: s.messageID(), Text: line}
+		}), false, nil
+	}
+
+	args := strings.Fields(line)
+	switch args[0] {
+	case "/quit", "/exit":
+		return nil, true, nil
+
+	case "/help":
+		fmt.Fprintln(s.out, usage)
+		return nil, false, nil
+
+	case "/json":
+		s.json = !s.json
+		fmt.Fprintf(s.out, "JSON表示: %v\n", s.json)
+		return nil, false, nil
+
+	case "/user", "/group":
+		if len(args) != 2 {
+			return nil, false, errors.New("使い方: " + args[0] + " <ID>")
+		}
+		if args[0] == "/user" {
+			s.source = userSource(args[1])
+		} else {
+			s.source = &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: args[1], UserID: s.source.UserID}
+		}
+		fmt.Fprintf(s.out, "送信元: %s %s\n", s.source.Type, args[1])
+		return nil, false, nil
+
+	case "/sticker":
+		if len(args) != 3 {
+			return nil, false, errors.New("使い方: /sticker <パッケージID> <スタンプID>")
+		}
+		return s.newEvent(linebot.EventTypeMessage, func(e *linebot.Event) {
+			e.Message = &linebot.StickerMessage{
+				ID:                  s.messageID(),
+				PackageID:           args[1],
+				StickerID:           args[2],
+				StickerResourceType: linebot.StickerResourceTypeStatic,
+			}
+		}), false, nil
+
+	case "/location":
+		if len(args) < 3 {
+			return nil, false, errors.New("使い方: /location <緯度> <経度> [名前]")
+		}
+		lat, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("緯度が数値ではありません: %v", args[1])
+		}
+		lon, err := strconv.ParseFloat(args[2], 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("経度が数値ではありません: %v", args[2])
+		}
+		return s.newEvent(linebot.EventTypeMessage, func(e *linebot.Event) {
+			e.Message = &linebot.LocationMessage{
+				ID:        s.messageID(),
+				Title:     strings.Join(args[3:], " "),
+				Latitude:  lat,
+				Longitude: lon,
+			}
+		}), false, nil
+
+	case "/postback":
+		if len(args) < 2 {
+			return nil, false, errors.New("使い方: /postback <データ>")
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, args[0]))
+		return s.newEvent(linebot.EventTypePostback, func(e *linebot.Event) {
+			e.Postback = &linebot.Postback{Data: data}
+		}), false, nil
+
+	case "/follow":
+		return s.newEvent(linebot.EventTypeFollow, nil), false, nil
+	case "/unfollow":
+		return s.newEvent(linebot.EventTypeUnfollow, nil), false, nil
+	case "/join":
+		return s.newEvent(linebot.EventTypeJoin, nil), false, nil
+	case "/leave":
+		return s.newEvent(linebot.EventTypeLeave, nil), false, nil
+	}
+	return nil, false, fmt.Errorf("知らないコマンドです: %s (/help で一覧を表示します)", args[0])
+}
+
+// newEvent は現在の送信元からのイベントを作る
+func (s *session) newEvent(eventType linebot.EventType, fill func(e *linebot.Event)) *linebot.Event {
+	s.count++
+	source := *s.source
+	event := &linebot.Event{
+		ReplyToken:     fmt.Sprintf("botcli-reply-%d", s.count),
+		Type:           eventType,
+		Mode:           linebot.EventModeActive,
+		Timestamp:      time.Now(),
+		Source:         &source,
+		WebhookEventID: fmt.Sprintf("botcli-event-%d", s.count),
+	}
+	if fill != nil {
+		fill(event)
+	}
+	return event
+}
+
+func (s *session) messageID() string {
+	return strconv.Itoa(s.count)
+}
+
+func userSource(userID string) *linebot.EventSource {
+	return &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: userID}
+}
@@ -0,0 +1,117 @@
+// botcli はLINEを使わずに、ターミナルからBotとやりとりするためのコマンド
+//
+// 入力したテキストやスタンプ・位置情報を Webhook のイベントとして
+// example/Step4.go と同じ処理(app.Register)に渡し、返信をターミナルに表示する
+//
+//	go run ./cmd/botcli
+//
+// データベースの設定(DB_*)があればTodoListを、APP_ID があれば天気確認を使える
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/app"
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+	"github.com/xxarupakaxx/sysad-linebot-handson/config"
+)
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "Flexメッセージなどを読みやすいテキストではなくJSONで表示する")
+	userID := flag.String("user", "Ubotcli", "メッセージを送るユーザーのID")
+	flag.Parse()
+
+	// LINEのAPIは使わないので、LINEの設定は必須にしない
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// データベースの設定があればTodoListを使えるようにする
+	var db *sqlx.DB
+	if err := cfg.Validate(config.Database); err == nil {
+		db, err = sqlx.Connect("mysql", cfg.DB.DSN())
+		if err != nil {
+			log.Printf("データベースに接続できなかったのでTodoListは使えません: %v", err)
+			db = nil
+		}
+	}
+
+	// 返信はLINEに送らずに Dispatch の戻り値で受け取るので、チャネルの設定は仮の値でよい
+	server, err := bot.New(orDefault(cfg.ChannelSecret, "botcli"), orDefault(cfg.ChannelAccessToken, "botcli"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.Register(server, cfg, db)
+
+	session := &session{
+		server: server,
+		source: userSource(*userID),
+		json:   *jsonOutput,
+		out:    os.Stdout,
+	}
+	fmt.Fprintln(os.Stdout, `Botとの会話を始めます。/help でコマンドの一覧を表示します。`)
+	if err := session.run(context.Background(), os.Stdin); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// session はターミナルでの1回分の会話
+type session struct {
+	server *bot.Server
+	source *linebot.EventSource
+	json   bool
+	out    io.Writer
+	// 作ったイベントの数。メッセージIDなどに使う
+	count int
+}
+
+// run は1行ずつ入力を読み込んでイベントにし、Botの返信を表示する
+func (s *session) run(ctx context.Context, in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(s.out, "you> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(s.out)
+			return scanner.Err()
+		}
+
+		event, quit, err := s.parse(scanner.Text())
+		if quit {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			continue
+		}
+		if event == nil {
+			continue
+		}
+
+		reply := s.server.Dispatch(ctx, event)
+		if reply == nil {
+			fmt.Fprintln(s.out, "(返信なし)")
+			continue
+		}
+		if err := render(s.out, reply, s.json); err != nil {
+			fmt.Fprintln(s.out, err)
+		}
+	}
+}
+
+func orDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// render は返信を表示する
+// asJSON が false のときは、Flexメッセージなどを文字だけの読みやすい形にする
+func render(w io.Writer, message linebot.SendingMessage, asJSON bool) error {
+	// 送信するメッセージの種類ごとの構造体は中身を直接読めないものがあるので、
+	// LINEのAPIに送るときと同じJSONにしてから表示する
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		var out bytes.Buffer
+		if err := json.Indent(&out, data, "", "  "); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "bot> %s\n", out.String())
+		return nil
+	}
+
+	var node map[string]interface{}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	r := &renderer{}
+	r.message(node)
+	for i, line := range r.lines {
+		if i == 0 {
+			fmt.Fprintf(w, "bot> %s\n", line)
+		} else {
+			fmt.Fprintf(w, "     %s\n", line)
+		}
+	}
+	return nil
+}
+
+// renderer はJSONにしたメッセージを1行ずつの文字にする
+type renderer struct {
+	lines  []string
+	indent int
+}
+
+func (r *renderer) println(format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	for _, line := range strings.Split(text, "\n") {
+		r.lines = append(r.lines, strings.Repeat("  ", r.indent)+line)
+	}
+}
+
+func (r *renderer) message(node map[string]interface{}) {
+	switch str(node, "type") {
+	case "text":
+		r.println("%s", str(node, "text"))
+	case "sticker":
+		r.println("[スタンプ %s/%s]", str(node, "packageId"), str(node, "stickerId"))
+	case "image":
+		r.println("[画像 %s]", str(node, "originalContentUrl"))
+	case "location":
+		r.println("[位置情報 %s %s (%v, %v)]", str(node, "title"), str(node, "address"), node["latitude"], node["longitude"])
+	case "flex":
+		r.println("[Flex %s]", str(node, "altText"))
+		r.flex(obj(node, "contents"))
+	case "template":
+		r.println("[テンプレート %s]", str(node, "altText"))
+		r.template(obj(node, "template"))
+	default:
+		data, _ := json.Marshal(node)
+		r.println("%s", data)
+	}
+
+	// クイックリプライのボタン
+	if quickReply := obj(node, "quickReply"); quickReply != nil {
+		var labels []string
+		for _, item := range list(quickReply, "items") {
+			labels = append(labels, "["+actionLabel(obj(item, "action"))+"]")
+		}
+		r.println("クイックリプライ: %s", strings.Join(labels, " "))
+	}
+}
+
+// flex はFlexメッセージの中身をたどって文字やボタンを表示する
+func (r *renderer) flex(node map[string]interface{}) {
+	if node == nil {
+		return
+	}
+	switch str(node, "type") {
+	case "carousel":
+		for i, bubble := range list(node, "contents") {
+			r.println("--- %d ---", i+1)
+			r.flex(bubble)
+		}
+	case "bubble":
+		for _, block := range []string{"header", "hero", "body", "footer"} {
+			r.flex(obj(node, block))
+		}
+	case "box":
+		for _, content := range list(node, "contents") {
+			r.flex(content)
+		}
+	case "text":
+		text := str(node, "text")
+		// contents(span)があるときはそちらが表示される
+		if spans := list(node, "contents"); len(spans) > 0 {
+			var b strings.Builder
+			for _, span := range spans {
+				b.WriteString(str(span, "text"))
+			}
+			text = b.String()
+		}
+		r.println("%s", strings.TrimRight(text, "\n"))
+	case "image":
+		r.println("[画像 %s]", str(node, "url"))
+	case "button":
+		r.println("[ボタン %s]", actionLabel(obj(node, "action")))
+	case "separator":
+		r.println("----")
+	}
+}
+
+func (r *renderer) template(node map[string]interface{}) {
+	if node == nil {
+		return
+	}
+	if title := str(node, "title"); title != "" {
+		r.println("%s", title)
+	}
+	if text := str(node, "text"); text != "" {
+		r.println("%s", text)
+	}
+	for _, action := range list(node, "actions") {
+		r.println("[ボタン %s]", actionLabel(action))
+	}
+	for i, column := range list(node, "columns") {
+		r.println("--- %d ---", i+1)
+		r.indent++
+		r.template(column)
+		r.indent--
+	}
+}
+
+// actionLabel はボタンに表示される文字と、押したときに送られる内容を返す
+func actionLabel(action map[string]interface{}) string {
+	label := str(action, "label")
+	switch str(action, "type") {
+	case "message":
+		return fmt.Sprintf("%s → %q", label, str(action, "text"))
+	case "postback":
+		return fmt.Sprintf("%s → /postback %s", label, str(action, "data"))
+	case "uri":
+		return fmt.Sprintf("%s → %s", label, str(action, "uri"))
+	default:
+		return label
+	}
+}
+
+func str(node map[string]interface{}, key string) string {
+	s, _ := node[key].(string)
+	return s
+}
+
+func obj(node map[string]interface{}, key string) map[string]interface{} {
+	o, _ := node[key].(map[string]interface{})
+	return o
+}
+
+func list(node map[string]interface{}, key string) []map[string]interface{} {
+	items, _ := node[key].([]interface{})
+	objs := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if o, ok := item.(map[string]interface{}); ok {
+			objs = append(objs, o)
+		}
+	}
+	return objs
+}
@@ -0,0 +1,166 @@
+// webhooksim はLINEサーバの代わりに、署名付きのWebhookを起動中のBotへ送るコマンド
+//
+//	go run ./cmd/webhooksim text こんにちは
+//	go run ./cmd/webhooksim sticker 446 1988
+//	go run ./cmd/webhooksim location 35.681 139.767
+//	go run ./cmd/webhooksim postback action=done
+//	go run ./cmd/webhooksim follow
+//	go run ./cmd/webhooksim join
+//
+// -record を指定すると偽物のMessaging APIを起動し、Botからの返信を表示する
+// そのときは Bot を LINE_API_ENDPOINT=http://localhost:9090 のように設定して起動しておく
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/config"
+	"github.com/xxarupakaxx/sysad-linebot-handson/linetest"
+)
+
+const usage = `使い方: webhooksim [フラグ] <イベント> [引数...]
+
+イベント:
+	text <テキスト>
+	sticker <パッケージID> <スタンプID>
+	location <緯度> <経度> [名前]
+	postback <データ>
+	follow
+	join
+
+フラグ:`
+
+func main() {
+	url := flag.String("url", "", "Webhookを送る先 (初期値は http://localhost:$PORT/callback)")
+	secret := flag.String("secret", "", "署名に使うチャネルシークレット (初期値は CHANNEL_SECRET)")
+	userID := flag.String("user", "Uwebhooksim", "送信したユーザーのID")
+	groupID := flag.String("group", "", "グループから送ったことにするときのグループID")
+	redeliver := flag.Bool("redeliver", false, "再送されたイベントとして送る")
+	record := flag.String("record", "", "偽物のMessaging APIを起動するアドレス (例: :9090)")
+	wait := flag.Duration("wait", 5*time.Second, "-record のときにBotからの返信を待つ時間")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *url == "" {
+		*url = fmt.Sprintf("http://localhost%s/callback", cfg.Addr())
+	}
+	if *secret == "" {
+		*secret = cfg.ChannelSecret
+	}
+	if *secret == "" {
+		log.Fatal("チャネルシークレットが分かりません。-secret か CHANNEL_SECRET を指定してください")
+	}
+
+	source := linetest.User(*userID)
+	if *groupID != "" {
+		source = linetest.Group(*groupID, *userID)
+	}
+	event, err := newEvent(source, flag.Args())
+	if err != nil {
+		flag.Usage()
+		log.Fatal(err)
+	}
+	if *redeliver {
+		event.Redelivered()
+	}
+
+	// Botからの返信を受け取るために、Webhookを送る前に偽物のAPIを起動しておく
+	var api *linetest.API
+	if *record != "" {
+		api, err = linetest.NewAPIAt(*record)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer api.Close()
+		log.Printf("偽物のMessaging APIを %s で起動しました", api.URL())
+	}
+
+	simulator := &linetest.Simulator{URL: *url, ChannelSecret: *secret, API: api}
+	res, err := simulator.Send(context.Background(), event)
+	if err != nil {
+		log.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	log.Printf("%s %s → %s %s", event.Type, event.WebhookEventID, res.Status, strings.TrimSpace(string(body)))
+
+	if api == nil {
+		return
+	}
+	// Botはイベントを裏側で処理するので、返信が届くまで待つ
+	ctx, cancel := context.WithTimeout(context.Background(), *wait)
+	defer cancel()
+	calls, err := api.Wait(ctx, 1)
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("%s 待ちましたが、Botからの呼び出しはありませんでした", *wait)
+		os.Exit(1)
+	}
+	for _, call := range calls {
+		fmt.Printf("%s %s\n%s\n", call.Method, call.Path, call.Body)
+	}
+}
+
+// newEvent はコマンドライン引数からイベントを作る
+func newEvent(source *linebot.EventSource, args []string) (*linetest.Event, error) {
+	if len(args) == 0 {
+		return nil, errors.New("イベントの種類を指定してください")
+	}
+	switch kind, rest := args[0], args[1:]; kind {
+	case "text":
+		if len(rest) == 0 {
+			return nil, errors.New("送るテキストを指定してください")
+		}
+		return linetest.TextEvent(source, strings.Join(rest, " ")), nil
+	case "sticker":
+		if len(rest) != 2 {
+			return nil, errors.New("パッケージIDとスタンプIDを指定してください")
+		}
+		return linetest.StickerEvent(source, rest[0], rest[1]), nil
+	case "location":
+		if len(rest) < 2 {
+			return nil, errors.New("緯度と経度を指定してください")
+		}
+		lat, err := strconv.ParseFloat(rest[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("緯度が数値ではありません: %v", rest[0])
+		}
+		lon, err := strconv.ParseFloat(rest[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("経度が数値ではありません: %v", rest[1])
+		}
+		return linetest.LocationEvent(source, strings.Join(rest[2:], " "), "", lat, lon), nil
+	case "postback":
+		if len(rest) == 0 {
+			return nil, errors.New("ポストバックのデータを指定してください")
+		}
+		return linetest.PostbackEvent(source, strings.Join(rest, " ")), nil
+	case "follow":
+		return linetest.FollowEvent(source.UserID), nil
+	case "join":
+		groupID := source.GroupID
+		if groupID == "" {
+			groupID = "Cwebhooksim"
+		}
+		return linetest.JoinEvent(groupID), nil
+	default:
+		return nil, fmt.Errorf("知らないイベントです: %s", kind)
+	}
+}
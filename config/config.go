@@ -0,0 +1,330 @@
+// Package config はBotを動かすための設定を読み込むパッケージ
+//
+// 設定は次の順に読み込み、後から読み込んだものが優先される
+//  1. 初期値
+//  2. 環境変数 CONFIG_FILE で指定したYAML(.yaml, .yml)またはTOML(.toml)ファイル
+//  3. .envファイル
+//  4. 環境変数
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Feature は設定が必要な機能の種類
+// Load に渡した機能で必要な項目が設定されていないとエラーになる
+type Feature string
+
+// Feature の一覧
+const (
+	// LINE はLINEのAPIを使うのに必要な設定
+	LINE Feature = "line"
+	// Weather は天気確認機能に必要な設定
+	// WEATHER_PROVIDER が openweathermap のときは APP_ID も必要になる
+	Weather Feature = "weather"
+	// Database はMySQLデータベースを使うのに必要な設定
+	Database Feature = "database"
+)
+
+// Config はBotを動かすための設定
+// env タグは環境変数と.envファイルでの名前、secret タグが付いた項目は表示するときに隠す
+type Config struct {
+	ChannelSecret      string `env:"CHANNEL_SECRET" yaml:"channel_secret" toml:"channel_secret" required:"line" secret:"true"`
+	ChannelAccessToken string `env:"CHANNEL_ACCESS_TOKEN" yaml:"channel_access_token" toml:"channel_access_token" required:"line" secret:"true"`
+	Port               int    `env:"PORT" yaml:"port" toml:"port"`
+	// APIEndpoint はMessaging APIの呼び出し先。空のときは本物のLINEのAPIを使う
+	// cmd/webhooksim などの偽物のAPIに返信を送りたいときに設定する
+	APIEndpoint string `env:"LINE_API_ENDPOINT" yaml:"api_endpoint" toml:"api_endpoint"`
+
+	// Workers はイベントを同時に処理するワーカーの数
+	Workers int `env:"WORKERS" yaml:"workers" toml:"workers"`
+	// ShutdownTimeout は終了するときに処理中のイベントを待つ時間の上限
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+
+	// WeatherProvider は天気の情報を取得するサービス(openweathermap または jma)
+	WeatherProvider string `env:"WEATHER_PROVIDER" yaml:"weather_provider" toml:"weather_provider"`
+	// AppID はOpenWeatherMapAPIのAPIキー
+	AppID string `env:"APP_ID" yaml:"app_id" toml:"app_id" secret:"true"`
+	// WeatherRateLimit は天気の情報を取得するサービスへの1分あたりの問い合わせの上限。0のときは制限しない
+	WeatherRateLimit int `env:"WEATHER_RATE_LIMIT" yaml:"weather_rate_limit" toml:"weather_rate_limit"`
+	// WeatherRateBurst は一度に続けて問い合わせられる回数。WeatherRateLimit が0のときは使わない
+	WeatherRateBurst int `env:"WEATHER_RATE_BURST" yaml:"weather_rate_burst" toml:"weather_rate_burst"`
+
+	// Admins は管理者のLINEユーザーID。カンマ区切りで複数指定できる
+	// 管理者は共有しているTodoListで、他の人が追加したTodoも削除できる
+	Admins []string `env:"ADMIN_USER_IDS" yaml:"admin_user_ids" toml:"admin_user_ids"`
+	// TodoReminders はTodoの期限のどれだけ前にリマインダーを送るか。カンマ区切りで複数指定できる (例: 24h,1h)
+	TodoReminders []time.Duration `env:"TODO_REMINDERS" yaml:"todo_reminders" toml:"todo_reminders"`
+
+	DB DBConfig `yaml:"db" toml:"db"`
+}
+
+// DBConfig はMySQLデータベースへの接続設定
+type DBConfig struct {
+	Username string `env:"DB_USERNAME" yaml:"username" toml:"username" required:"database"`
+	Password string `env:"DB_PASSWORD" yaml:"password" toml:"password" secret:"true"`
+	Hostname string `env:"DB_HOSTNAME" yaml:"hostname" toml:"hostname" required:"database"`
+	Port     int    `env:"DB_PORT" yaml:"port" toml:"port"`
+	Database string `env:"DB_DATABASE" yaml:"database" toml:"database" required:"database"`
+}
+
+// DSN はデータベースへ接続するための文字列を返す
+func (c DBConfig) DSN() string {
+	user := c.Username
+	if c.Password != "" {
+		user += ":" + c.Password
+	}
+	return fmt.Sprintf("%v@tcp(%v:%v)/%v?charset=utf8&parseTime=True&loc=Local", user, c.Hostname, c.Port, c.Database)
+}
+
+// Default は初期値の設定を返す
+func Default() *Config {
+	return &Config{
+		// .gitpod.yml で公開しているポート
+		Port:            8080,
+		Workers:         4,
+		WeatherProvider: "openweathermap",
+		// OpenWeatherMapAPIの無料プランの上限は1分あたり60回
+		WeatherRateLimit: 60,
+		WeatherRateBurst: 10,
+		ShutdownTimeout:  30 * time.Second,
+		TodoReminders:    []time.Duration{24 * time.Hour, time.Hour},
+		DB: DBConfig{
+			Port: 3306,
+		},
+	}
+}
+
+// Load は設定を読み込み、features に必要な項目が揃っているかを確認する
+func Load(features ...Feature) (*Config, error) {
+	dotenv, err := readDotenv(".env")
+	if err != nil {
+		return nil, err
+	}
+	lookup := func(key string) (string, bool) {
+		if value, ok := os.LookupEnv(key); ok {
+			return value, true
+		}
+		value, ok := dotenv[key]
+		return value, ok
+	}
+
+	c := Default()
+	if path, ok := lookup("CONFIG_FILE"); ok && path != "" {
+		if err := c.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.apply(lookup); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(features...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// readDotenv は.envファイルを読み込む
+// ファイルがないときは何も設定されていないものとして扱う
+func readDotenv(path string) (map[string]string, error) {
+	values, err := godotenv.Read(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: failed to read %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// readFile はYAMLまたはTOMLの設定ファイルを読み込む
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: failed to read %s: %w", path, err)
+	}
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("config: unsupported config file type %q (use .yaml, .yml or .toml)", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("config: failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// apply は lookup で見つかった値で env タグの付いた項目を上書きする
+func (c *Config) apply(lookup func(key string) (string, bool)) error {
+	return walk(reflect.ValueOf(c).Elem(), func(field reflect.StructField, value reflect.Value) error {
+		key := field.Tag.Get("env")
+		raw, ok := lookup(key)
+		if !ok {
+			return nil
+		}
+		if err := set(value, raw); err != nil {
+			return fmt.Errorf("config: invalid %s %q: %w", key, raw, err)
+		}
+		return nil
+	})
+}
+
+// Validate は features に必要な項目が設定されていて、数値の項目が正しい範囲にあるかを確認する
+// 問題があった項目はすべてまとめてエラーにする
+func (c *Config) Validate(features ...Feature) error {
+	required := make(map[string]bool, len(features))
+	for _, feature := range features {
+		required[string(feature)] = true
+	}
+
+	var problems []string
+	walk(reflect.ValueOf(c).Elem(), func(field reflect.StructField, value reflect.Value) error {
+		feature := field.Tag.Get("required")
+		if required[feature] && value.IsZero() {
+			problems = append(problems, fmt.Sprintf("%s is required for %s", field.Tag.Get("env"), feature))
+		}
+		return nil
+	})
+	if required[string(Weather)] {
+		switch c.WeatherProvider {
+		case "openweathermap":
+			if c.AppID == "" {
+				problems = append(problems, "APP_ID is required for weather when WEATHER_PROVIDER is openweathermap")
+			}
+		case "jma":
+		default:
+			problems = append(problems, fmt.Sprintf("WEATHER_PROVIDER must be openweathermap or jma, got %q", c.WeatherProvider))
+		}
+	}
+	if c.WeatherRateLimit < 0 {
+		problems = append(problems, fmt.Sprintf("WEATHER_RATE_LIMIT must not be negative, got %d", c.WeatherRateLimit))
+	}
+	// WEATHER_RATE_LIMIT が0のときは制限しないので、WEATHER_RATE_BURST は使わない
+	if c.WeatherRateLimit > 0 && c.WeatherRateBurst <= 0 {
+		problems = append(problems, fmt.Sprintf("WEATHER_RATE_BURST must be positive, got %d", c.WeatherRateBurst))
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT must be between 1 and 65535, got %d", c.Port))
+	}
+	if c.Workers <= 0 {
+		problems = append(problems, fmt.Sprintf("WORKERS must be positive, got %d", c.Workers))
+	}
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, fmt.Sprintf("SHUTDOWN_TIMEOUT must be positive, got %s", c.ShutdownTimeout))
+	}
+	for _, d := range c.TodoReminders {
+		if d <= 0 {
+			problems = append(problems, fmt.Sprintf("TODO_REMINDERS must be positive, got %s", d))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Addr はサーバが待ち受けるアドレスを返す
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
+
+// String は実際に使われる設定を表示用の文字列にする
+// secret タグが付いた項目は値を隠す
+func (c *Config) String() string {
+	var b strings.Builder
+	walk(reflect.ValueOf(c).Elem(), func(field reflect.StructField, value reflect.Value) error {
+		shown := fmt.Sprint(value.Interface())
+		if field.Tag.Get("secret") == "true" && !value.IsZero() {
+			shown = "********"
+		}
+		fmt.Fprintf(&b, "%s=%s\n", field.Tag.Get("env"), shown)
+		return nil
+	})
+	return b.String()
+}
+
+// walk は env タグの付いた項目それぞれについて fn を呼び出す
+// env タグのない構造体の項目はその中の項目をたどる
+func walk(v reflect.Value, fn func(field reflect.StructField, value reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+		if _, ok := field.Tag.Lookup("env"); !ok {
+			if field.Type.Kind() == reflect.Struct {
+				if err := walk(value, fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := fn(field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set は文字列 raw を項目の型に変換して設定する
+func set(value reflect.Value, raw string) error {
+	if value.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Slice:
+		// カンマ区切りで複数の値を指定する
+		items := reflect.MakeSlice(value.Type(), 0, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			elem := reflect.New(value.Type().Elem()).Elem()
+			if err := set(elem, item); err != nil {
+				return err
+			}
+			items = reflect.Append(items, elem)
+		}
+		value.Set(items)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
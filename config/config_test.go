@@ -0,0 +1,149 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chdir はテストの間だけ作業ディレクトリを dir にする
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// unsetenv はテストの間だけ環境変数 key を消す
+func unsetenv(t *testing.T, key string) {
+	t.Helper()
+	// t.Setenv がテストの後に元の値に戻す
+	t.Setenv(key, "")
+	os.Unsetenv(key)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 初期値 < CONFIG_FILE < .env < 環境変数 の順に優先される
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	writeFile(t, filepath.Join(dir, "config.yaml"), "port: 1000\nworkers: 2\nweather_rate_burst: 3\nshutdown_timeout: 5s\n")
+	writeFile(t, filepath.Join(dir, ".env"), "PORT=2000\nWORKERS=5\nCONFIG_FILE=config.yaml\n")
+	for _, key := range []string{"CONFIG_FILE", "WORKERS", "WEATHER_RATE_BURST", "SHUTDOWN_TIMEOUT", "WEATHER_RATE_LIMIT"} {
+		unsetenv(t, key)
+	}
+	t.Setenv("PORT", "3000")
+
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != 3000 {
+		t.Errorf("got PORT %d, want 3000 from the environment", c.Port)
+	}
+	if c.Workers != 5 {
+		t.Errorf("got WORKERS %d, want 5 from .env", c.Workers)
+	}
+	if c.WeatherRateBurst != 3 || c.ShutdownTimeout != 5*time.Second {
+		t.Errorf("got WEATHER_RATE_BURST %d and SHUTDOWN_TIMEOUT %s, want 3 and 5s from CONFIG_FILE", c.WeatherRateBurst, c.ShutdownTimeout)
+	}
+	if c.WeatherRateLimit != 60 {
+		t.Errorf("got WEATHER_RATE_LIMIT %d, want the default 60", c.WeatherRateLimit)
+	}
+}
+
+func TestReadTOMLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	writeFile(t, path, "port = 1000\ntodo_reminders = [\"2h\"]\n[db]\nhostname = \"db.example.com\"\n")
+
+	c := Default()
+	if err := c.readFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != 1000 || c.DB.Hostname != "db.example.com" || !reflect.DeepEqual(c.TodoReminders, []time.Duration{2 * time.Hour}) {
+		t.Errorf("got %+v", c)
+	}
+}
+
+func TestApplyParsesDurationsAndSlices(t *testing.T) {
+	values := map[string]string{
+		"SHUTDOWN_TIMEOUT": "1m30s",
+		// 空の要素と前後の空白は無視する
+		"TODO_REMINDERS": "48h, ,30m",
+		"ADMIN_USER_IDS": "Ualice, Ubob",
+	}
+	c := Default()
+	err := c.apply(func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ShutdownTimeout != 90*time.Second {
+		t.Errorf("got SHUTDOWN_TIMEOUT %s, want 1m30s", c.ShutdownTimeout)
+	}
+	if want := []time.Duration{48 * time.Hour, 30 * time.Minute}; !reflect.DeepEqual(c.TodoReminders, want) {
+		t.Errorf("got TODO_REMINDERS %v, want %v", c.TodoReminders, want)
+	}
+	if want := []string{"Ualice", "Ubob"}; !reflect.DeepEqual(c.Admins, want) {
+		t.Errorf("got ADMIN_USER_IDS %q, want %q", c.Admins, want)
+	}
+}
+
+func TestApplyRejectsInvalidValues(t *testing.T) {
+	for key, value := range map[string]string{"SHUTDOWN_TIMEOUT": "30", "TODO_REMINDERS": "24h,soon", "PORT": "http"} {
+		c := Default()
+		err := c.apply(func(k string) (string, bool) { return value, k == key })
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("%s=%s: got %v, want an error about %s", key, value, err, key)
+		}
+	}
+}
+
+func TestValidateRateBurst(t *testing.T) {
+	c := Default()
+	c.WeatherRateBurst = 0
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "WEATHER_RATE_BURST") {
+		t.Errorf("got %v, want an error about WEATHER_RATE_BURST", err)
+	}
+	// 制限しないときは WEATHER_RATE_BURST を使わない
+	c.WeatherRateLimit = 0
+	if err := c.Validate(); err != nil {
+		t.Errorf("got %v with rate limiting off, want no error", err)
+	}
+}
+
+func TestStringHidesSecrets(t *testing.T) {
+	c := Default()
+	c.ChannelSecret = "channel-secret-value"
+	c.AppID = "app-id-value"
+	c.DB.Password = "db-password-value"
+	c.DB.Username = "root"
+
+	s := c.String()
+	for _, secret := range []string{c.ChannelSecret, c.AppID, c.DB.Password} {
+		if strings.Contains(s, secret) {
+			t.Errorf("got %q, want %q to be hidden", s, secret)
+		}
+	}
+	for _, want := range []string{"CHANNEL_SECRET=********\n", "DB_PASSWORD=********\n", "DB_USERNAME=root\n", "PORT=8080\n", "CHANNEL_ACCESS_TOKEN=\n"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("got %q, want it to contain %q", s, want)
+		}
+	}
+}
@@ -1,77 +1,52 @@
+//go:build ignore
+
 // #1 やまびこの実装
 package main
 
 // 利用したい外部のコードを読み込む
 import (
+	"context"
 	"fmt"
-	"github.com/joho/godotenv"
 	"log"
-	"net/http"
-	"os"
 
 	"github.com/line/line-bot-sdk-go/v7/linebot"
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+	"github.com/xxarupakaxx/sysad-linebot-handson/config"
 )
 
-
 // main関数は最初に呼び出されることがGo言語の仕様として決まっている
 func main() {
-	// ここで.envファイル全体を読み込みます。
-	// この読み込み処理がないと、個々の環境変数が取得出来ません。
-	// 読み込めなかったら err にエラーが入ります。
-	err := godotenv.Load(".env")
-
-	// もし err がnilではないなら、"読み込み出来ませんでした"が出力されます。
+	// ここで.envファイルや環境変数から設定を読み込みます。
+	// 必要な設定が足りなければ、足りない項目を表示して終了します。
+	cfg, err := config.Load(config.LINE)
 	if err != nil {
-		fmt.Printf("読み込み出来ませんでした: %v", err)
+		log.Fatal(err)
 	}
+	log.Printf("設定:\n%s", cfg)
 
 	// LINEのAPIを利用する設定
-	bot, err := linebot.New(
-		os.Getenv("CHANNEL_SECRET"),
-		os.Getenv("CHANNEL_ACCESS_TOKEN"),
+	server, err := bot.New(
+		cfg.ChannelSecret,
+		cfg.ChannelAccessToken,
+		bot.WithEndpointBase(cfg.APIEndpoint),
+		bot.WithWorkers(cfg.Workers),
+		bot.WithShutdownTimeout(cfg.ShutdownTimeout),
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// メッセージが来たときに返信を生成する処理を登録する
+	server.HandleMessage(func(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+		return linebot.NewTextMessage(getReplyMessage(event))
+	})
+
 	// サーバ起動メッセージ
 	log.Println("サーバが起動しました!")
 
-	// LINEサーバからのリクエストを受け取ったときの処理
-	http.HandleFunc("/callback", func(w http.ResponseWriter, req *http.Request) {
-		log.Println("Accessed")
-
-		// リクエストを扱いやすい形に変換する
-		events, err := bot.ParseRequest(req)
-		if err != nil {
-			if err == linebot.ErrInvalidSignature {
-				w.WriteHeader(http.StatusBadRequest)
-			} else {
-				w.WriteHeader(http.StatusInternalServerError)
-			}
-			return
-		}
-
-		// LINEサーバから来たメッセージによって行う処理を変える
-		for _, event := range events {
-			switch event.Type {
-			// メッセージが来たとき
-			case linebot.EventTypeMessage:
-				// 返信を生成する
-				replyMessage := getReplyMessage(event)
-				// 生成した返信を送信する
-				if _, err = bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(replyMessage)).Do(); err != nil {
-					log.Print(err)
-				}
-			// それ以外のとき
-			default:
-				continue
-			}
-		}
-	})
-
 	// LINEサーバからのリクエストを受け取るプロセスを起動
-	if err := http.ListenAndServe(":"+os.Getenv("PORT"), nil); err != nil {
+	// Ctrl+C などで終了するときは、処理中の返信を送り終わるまで待つ
+	if err := server.Run(cfg.Addr()); err != nil {
 		log.Fatal(err)
 	}
 }
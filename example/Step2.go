@@ -1,85 +1,52 @@
+//go:build ignore
+
 // #2 おみくじの実装
 package main
 
 // 利用したい外部のコードを読み込む
 import (
+	"context"
 	"fmt"
-	"github.com/joho/godotenv"
 	"log"
-	"math/rand"
-	"net/http"
-	"os"
-	"strings"
-	"time"
+	"regexp"
 
 	"github.com/line/line-bot-sdk-go/v7/linebot"
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+	"github.com/xxarupakaxx/sysad-linebot-handson/config"
+	"github.com/xxarupakaxx/sysad-linebot-handson/omikuji"
 )
 
-// init関数はmain関数実行前の初期化のために呼び出されることがGo言語の仕様として決まっている
-func init() {
-	// ランダムな数値を生成する際のシード値の設定
-	rand.Seed(time.Now().UnixNano())
-}
-
 // main関数は最初に呼び出されることがGo言語の仕様として決まっている
 func main() {
-	// ここで.envファイル全体を読み込みます。
-	// この読み込み処理がないと、個々の環境変数が取得出来ません。
-	// 読み込めなかったら err にエラーが入ります。
-	err := godotenv.Load(".env")
-
-	// もし err がnilではないなら、"読み込み出来ませんでした"が出力されます。
+	// ここで.envファイルや環境変数から設定を読み込みます。
+	// 必要な設定が足りなければ、足りない項目を表示して終了します。
+	cfg, err := config.Load(config.LINE)
 	if err != nil {
-		fmt.Printf("読み込み出来ませんでした: %v", err)
+		log.Fatal(err)
 	}
+	log.Printf("設定:\n%s", cfg)
 
 	// LINEのAPIを利用する設定
-	bot, err := linebot.New(
-		os.Getenv("CHANNEL_SECRET"),
-		os.Getenv("CHANNEL_ACCESS_TOKEN"),
+	server, err := bot.New(
+		cfg.ChannelSecret,
+		cfg.ChannelAccessToken,
+		bot.WithEndpointBase(cfg.APIEndpoint),
+		bot.WithWorkers(cfg.Workers),
+		bot.WithShutdownTimeout(cfg.ShutdownTimeout),
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// メッセージが来たときに返信を生成する処理を登録する
+	server.HandleMessage(newRouter().HandleMessage)
+
 	// サーバ起動メッセージ
 	log.Println("サーバが起動しました!")
 
-	// LINEサーバからのリクエストを受け取ったときの処理
-	http.HandleFunc("/callback", func(w http.ResponseWriter, req *http.Request) {
-		log.Println("Accessed")
-
-		// リクエストを扱いやすい形に変換する
-		events, err := bot.ParseRequest(req)
-		if err != nil {
-			if err == linebot.ErrInvalidSignature {
-				w.WriteHeader(http.StatusBadRequest)
-			} else {
-				w.WriteHeader(http.StatusInternalServerError)
-			}
-			return
-		}
-
-		// LINEサーバから来たメッセージによって行う処理を変える
-		for _, event := range events {
-			switch event.Type {
-			// メッセージが来たとき
-			case linebot.EventTypeMessage:
-				// 返信を生成する
-				replyMessage := getReplyMessage(event)
-				// 生成した返信を送信する
-				if _, err = bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(replyMessage)).Do(); err != nil {
-					log.Print(err)
-				}
-			// それ以外のとき
-			default:
-				continue
-			}
-		}
-	})
-
 	// LINEサーバからのリクエストを受け取るプロセスを起動
-	if err := http.ListenAndServe(":"+os.Getenv("PORT"), nil); err != nil {
+	// Ctrl+C などで終了するときは、処理中の返信を送り終わるまで待つ
+	if err := server.Run(cfg.Addr()); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -93,44 +60,28 @@ const helpMessage = `使い方
 それ以外:
 	それ以外にはまだ対応してないよ！ごめんね...`
 
-// 返信を生成する
-func getReplyMessage(event *linebot.Event) (replyMessage string) {
-	// 来たメッセージの種類によって行う処理を変える
-	switch message := event.Message.(type) {
-	// テキストメッセージが来たとき
-	case *linebot.TextMessage:
-		// さらに「おみくじ」という文字列が含まれているとき
-		if strings.Contains(message.Text, "おみくじ") {
-			// おみくじ結果を取得する
-			return getFortune()
-		}
-		// それ以外のときはオウム返しする
-		return message.Text
-
+// 来たメッセージによって返信を生成する処理を登録する
+func newRouter() *bot.Router {
+	router := bot.NewRouter()
+	// 「おみくじ」という文字列が含まれているとき
+	router.Handle(0, bot.Regexp(regexp.MustCompile("おみくじ")), omikuji.Handler)
 	// スタンプが来たとき
-	case *linebot.StickerMessage:
-		return fmt.Sprintf("sticker id is %v, stickerResourceType is %v", message.StickerID, message.StickerResourceType)
-
+	router.Handle(0, bot.MessageType(linebot.MessageTypeSticker), replySticker)
 	// それ以外のとき
-	default:
-		return helpMessage
-	}
+	router.Fallback(replyEcho)
+	return router
+}
+
+// スタンプの情報を返す
+func replySticker(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	message := event.Message.(*linebot.StickerMessage)
+	return linebot.NewTextMessage(fmt.Sprintf("sticker id is %v, stickerResourceType is %v", message.StickerID, message.StickerResourceType))
 }
 
-// おみくじ結果の生成
-func getFortune() string {
-	oracles := map[int]string{
-		0: "大吉",
-		1: "中吉",
-		2: "小吉",
-		3: "末吉",
-		4: "吉",
-		5: "凶",
-		6: "末凶",
-		7: "小凶",
-		8: "中凶",
-		9: "大凶",
+// テキストメッセージならオウム返しし、それ以外ならヘルプを返す
+func replyEcho(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	if text, ok := bot.Text(event); ok {
+		return linebot.NewTextMessage(text)
 	}
-	// rand.Intn(10)は1～10のランダムな整数を返す
-	return oracles[rand.Intn(len(oracles))]
+	return linebot.NewTextMessage(helpMessage)
 }
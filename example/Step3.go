@@ -1,88 +1,69 @@
+//go:build ignore
+
 // #3 天気確認機能の実装
 package main
 
 // 利用したい外部のコードを読み込む
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"github.com/joho/godotenv"
 	"log"
-	"math/rand"
-	"net/http"
-	"os"
-	"strconv"
-	"strings"
-	"time"
+	"regexp"
 
 	"github.com/line/line-bot-sdk-go/v7/linebot"
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+	"github.com/xxarupakaxx/sysad-linebot-handson/config"
+	"github.com/xxarupakaxx/sysad-linebot-handson/omikuji"
+	"github.com/xxarupakaxx/sysad-linebot-handson/weather"
 )
 
-
-// init関数はmain関数実行前の初期化のために呼び出されることがGo言語の仕様として決まっている
-func init() {
-	// ランダムな数値を生成する際のシード値の設定
-	rand.Seed(time.Now().UnixNano())
-}
-
 // main関数は最初に呼び出されることがGo言語の仕様として決まっている
 func main() {
-	// ここで.envファイル全体を読み込みます。
-	// この読み込み処理がないと、個々の環境変数が取得出来ません。
-	// 読み込めなかったら err にエラーが入ります。
-	err := godotenv.Load(".env")
-
-	// もし err がnilではないなら、"読み込み出来ませんでした"が出力されます。
+	// ここで.envファイルや環境変数から設定を読み込みます。
+	// 必要な設定が足りなければ、足りない項目を表示して終了します。
+	cfg, err := config.Load(config.LINE, config.Weather)
 	if err != nil {
-		fmt.Printf("読み込み出来ませんでした: %v", err)
+		log.Fatal(err)
 	}
+	log.Printf("設定:\n%s", cfg)
 
 	// LINEのAPIを利用する設定
-	bot, err := linebot.New(
-		os.Getenv("CHANNEL_SECRET"),
-		os.Getenv("CHANNEL_ACCESS_TOKEN"),
+	server, err := bot.New(
+		cfg.ChannelSecret,
+		cfg.ChannelAccessToken,
+		bot.WithEndpointBase(cfg.APIEndpoint),
+		bot.WithWorkers(cfg.Workers),
+		bot.WithShutdownTimeout(cfg.ShutdownTimeout),
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// サーバ起動メッセージ
-	log.Println("サーバが起動しました!")
+	// 天気の情報を取得するサービスの設定
+	// WEATHER_PROVIDER で OpenWeatherMapAPI (openweathermap) と気象庁 (jma) を切り替えられる
+	provider, err := weather.NewProvider(cfg.WeatherProvider, cfg.AppID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// 同じ場所の問い合わせは覚えた結果を使い、問い合わせすぎないように制限する
+	// 無料プランの上限を超えないように、1分あたり WEATHER_RATE_LIMIT 回までにする
+	provider = weather.NewCache(weather.NewRateLimited(provider, cfg.WeatherRateLimit, cfg.WeatherRateBurst))
 
-	// LINEサーバからのリクエストを受け取ったときの処理
-	http.HandleFunc("/callback", func(w http.ResponseWriter, req *http.Request) {
-		log.Println("Accessed")
+	weatherClient := weather.New(provider)
 
-		// リクエストを扱いやすい形に変換する
-		events, err := bot.ParseRequest(req)
-		if err != nil {
-			if err == linebot.ErrInvalidSignature {
-				w.WriteHeader(http.StatusBadRequest)
-			} else {
-				w.WriteHeader(http.StatusInternalServerError)
-			}
-			return
-		}
+	// メッセージが来たときに返信を生成する処理を登録する
+	server.HandleMessage(newRouter(weatherClient).HandleMessage)
+	// 位置情報への返信に付けたクイックリプライで、天気予報の見せ方が選ばれたときの処理を登録する
+	postbacks := bot.NewPostbackRouter()
+	postbacks.Handle(weather.PostbackAction, weatherClient.PostbackHandler)
+	server.HandlePostback(postbacks.HandlePostback)
 
-		// LINEサーバから来たメッセージによって行う処理を変える
-		for _, event := range events {
-			switch event.Type {
-			// メッセージが来たとき
-			case linebot.EventTypeMessage:
-				// 返信を生成する
-				replyMessage := getReplyMessage(event)
-				// 生成した返信を送信する
-				if _, err = bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(replyMessage)).Do(); err != nil {
-					log.Print(err)
-				}
-			// それ以外
-			default:
-				continue
-			}
-		}
-	})
+	// サーバ起動メッセージ
+	log.Println("サーバが起動しました!")
 
 	// LINEサーバからのリクエストを受け取るプロセスを起動
-	if err := http.ListenAndServe(":"+os.Getenv("PORT"), nil); err != nil {
+	// Ctrl+C などで終了するときは、処理中の返信を送り終わるまで待つ
+	if err := server.Run(cfg.Addr()); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -94,105 +75,34 @@ const helpMessage = `使い方
 スタンプ:
 	スタンプの情報を答えるよ！
 位置情報:
-	その場所の天気・気温・湿度を答えるよ！
+	その場所の天気・気温・湿度・風速を答えるよ！
 それ以外:
 	それ以外にはまだ対応してないよ！ごめんね...`
 
-// 返信を生成する
-func getReplyMessage(event *linebot.Event) (replyMessage string) {
-	// 来たメッセージの種類によって行う処理を変える
-	switch message := event.Message.(type) {
-	// テキストメッセージが来たとき
-	case *linebot.TextMessage:
-		// さらに「おみくじ」という文字列が含まれているとき
-		if strings.Contains(message.Text, "おみくじ") {
-			// おみくじ結果を取得する
-			return getFortune()
-		}
-		// それ以外のときはオウム返しする
-		return message.Text
-
+// 来たメッセージによって返信を生成する処理を登録する
+func newRouter(weatherClient *weather.Client) *bot.Router {
+	router := bot.NewRouter()
+	// 「おみくじ」という文字列が含まれているとき
+	router.Handle(0, bot.Regexp(regexp.MustCompile("おみくじ")), omikuji.Handler)
 	// スタンプが来たとき
-	case *linebot.StickerMessage:
-		return fmt.Sprintf("sticker id is %v, stickerResourceType is %v", message.StickerID, message.StickerResourceType)
-
-		// 位置情報が来たとき
-	case *linebot.LocationMessage:
-		// その場所の天気
-		replyMessage, err := getWeather(message)
-		if err != nil {
-			log.Print(err)
-		}
-		return replyMessage
-
+	router.Handle(0, bot.MessageType(linebot.MessageTypeSticker), replySticker)
+	// 位置情報が来たとき
+	router.Handle(0, bot.MessageType(linebot.MessageTypeLocation), weatherClient.CurrentHandler)
 	// それ以外のとき
-	default:
-		return helpMessage
-	}
-}
-
-// おみくじ結果の生成
-func getFortune() string {
-	oracles := map[int]string{
-		0: "大吉",
-		1: "中吉",
-		2: "小吉",
-		3: "末吉",
-		4: "吉",
-		5: "凶",
-		6: "末凶",
-		7: "小凶",
-		8: "中凶",
-		9: "大凶",
-	}
-	// rand.Intn(10)は1～10のランダムな整数を返す
-	return oracles[rand.Intn(len(oracles))]
-}
-
-// 天気の情報で帰ってくる形式 (1)
-type WeatherData struct {
-	Weather []Weather `json:"weather"`
-	Info    Info      `json:"main"`
-}
-
-// 天気の情報で帰ってくる形式 (2)
-type Weather struct {
-	Main string `json:"main"`
-	Icon string `json:"icon"` // 現状使わない
+	router.Fallback(replyEcho)
+	return router
 }
 
-// 天気の情報で帰ってくる形式 (3)
-type Info struct {
-	Temp     float32 `json:"temp"`     // 気温(K)
-	Humidity float32 `json:"humidity"` // 湿度(%)
+// スタンプの情報を返す
+func replySticker(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	message := event.Message.(*linebot.StickerMessage)
+	return linebot.NewTextMessage(fmt.Sprintf("sticker id is %v, stickerResourceType is %v", message.StickerID, message.StickerResourceType))
 }
 
-// 天気の情報の文字列をつくる
-func getWeather(location *linebot.LocationMessage) (string, error) {
-	// 緯度経度からOpenWeatherMapAPIのURLを作成
-	lat := strconv.FormatFloat(location.Latitude, 'f', 6, 64)
-	lon := strconv.FormatFloat(location.Longitude, 'f', 6, 64)
-	url := "https://api.openweathermap.org/data/2.5/weather?lat=" + lat + "&lon=" + lon + "&appid=" + os.Getenv("APP_ID")
-
-	// OpenWeatherMapAPIへのリクエスト
-	res, err := http.Get(url)
-	if err != nil {
-		return "Botサーバーでエラーが発生しました", err
+// テキストメッセージならオウム返しし、それ以外ならヘルプを返す
+func replyEcho(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	if text, ok := bot.Text(event); ok {
+		return linebot.NewTextMessage(text)
 	}
-	defer res.Body.Close()
-
-	// OpenWeatherMapAPIからのレスポンスを扱いやすい形に変換する
-	weatherData := WeatherData{}
-	err = json.NewDecoder(res.Body).Decode(&weatherData)
-	if err != nil {
-		return "Botサーバーでエラーが発生しました", err
-	}
-
-	// 返信メッセージの作成
-	text := ` 現在の天気情報
-天気 : ` + weatherData.Weather[0].Main + `
-気温 : ` + fmt.Sprintf("%.2f", (weatherData.Info.Temp-273.15)) + "℃" + `
-湿度 : ` + fmt.Sprintf("%.2f", weatherData.Info.Humidity) + "%"
-
-	return text, nil
+	return linebot.NewTextMessage(helpMessage)
 }
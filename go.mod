@@ -1,11 +1,12 @@
 module github.com/xxarupakaxx/sysad-linebot-handson
 
-go 1.18
+go 1.19
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/jmoiron/sqlx v1.3.4
-	github.com/line/line-bot-sdk-go/v7 v7.14.0
+	github.com/joho/godotenv v1.4.0
+	github.com/line/line-bot-sdk-go/v7 v7.21.0
+	gopkg.in/yaml.v3 v3.0.1
 )
-
-require github.com/joho/godotenv v1.4.0 // indirect
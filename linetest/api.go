@@ -0,0 +1,328 @@
+package linetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// ReplyTokenLifetime は返信用のトークンを使える時間の初期値
+const ReplyTokenLifetime = time.Minute
+
+// Call はBotから呼び出されたMessaging APIの記録
+type Call struct {
+	Method string
+	// Path は呼び出されたAPIのパス (例: /v2/bot/message/reply)
+	Path string
+	// Body はリクエストの本文
+	Body json.RawMessage
+	Time time.Time
+	// Status は API が返したステータスコード
+	Status int
+	// Error は API が呼び出しを断ったときの理由
+	Error string
+}
+
+// Reply は成功した返信 (/v2/bot/message/reply) の記録
+type Reply struct {
+	ReplyToken string            `json:"replyToken"`
+	Messages   []json.RawMessage `json:"messages"`
+}
+
+// Push は成功したプッシュメッセージ (/v2/bot/message/push) の記録
+type Push struct {
+	To       string            `json:"to"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// Multicast は成功したマルチキャストメッセージ (/v2/bot/message/multicast) の記録
+type Multicast struct {
+	To       []string          `json:"to"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// API はMessaging APIの代わりをするHTTPサーバ
+//
+// 呼び出しをすべて記録する。返信は IssueReplyToken で発行されたトークンのうち、
+// まだ使われておらず、発行から ReplyTokenLifetime 以内のものだけを受け付ける
+type API struct {
+	// ReplyTokenLifetime は返信用のトークンを使える時間
+	ReplyTokenLifetime time.Duration
+
+	server *httptest.Server
+
+	mu          sync.Mutex
+	calls       []Call
+	replies     []Reply
+	pushes      []Push
+	multicasts  []Multicast
+	replyTokens map[string]*replyToken
+	// changed は呼び出しが記録されるたびに閉じて作り直す
+	changed chan struct{}
+}
+
+type replyToken struct {
+	issuedAt time.Time
+	used     bool
+}
+
+// NewAPI は空いているポートで API を起動する
+func NewAPI() *API {
+	a := newAPI()
+	a.server = httptest.NewServer(a)
+	return a
+}
+
+// NewAPIAt は addr (例: :9090) で API を起動する
+// 別のプロセスで動いているBotからの呼び出しを記録するときに使う
+func NewAPIAt(addr string) (*API, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	a := newAPI()
+	a.server = httptest.NewUnstartedServer(a)
+	a.server.Listener.Close()
+	a.server.Listener = listener
+	a.server.Start()
+	return a, nil
+}
+
+func newAPI() *API {
+	return &API{
+		ReplyTokenLifetime: ReplyTokenLifetime,
+		replyTokens:        make(map[string]*replyToken),
+		changed:            make(chan struct{}),
+	}
+}
+
+// URL は API のURLを返す
+func (a *API) URL() string {
+	return a.server.URL
+}
+
+// ClientOption はLINEのAPIクライアントの呼び出し先をこの API にする設定を返す
+func (a *API) ClientOption() linebot.ClientOption {
+	return linebot.WithEndpointBase(a.URL())
+}
+
+// Close は API を止める
+func (a *API) Close() {
+	a.server.Close()
+}
+
+// IssueReplyToken は返信用のトークンを発行したことにする
+// Simulator の API を設定しておくと、送ったイベントのトークンは自動で発行される
+func (a *API) IssueReplyToken(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.replyTokens[token] = &replyToken{issuedAt: time.Now()}
+}
+
+// Calls はこれまでに記録した呼び出しを、断ったものも含めてすべて返す
+func (a *API) Calls() []Call {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Call(nil), a.calls...)
+}
+
+// Errors は API が断った呼び出しを返す
+func (a *API) Errors() []Call {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var errs []Call
+	for _, call := range a.calls {
+		if call.Error != "" {
+			errs = append(errs, call)
+		}
+	}
+	return errs
+}
+
+// Replies は成功した返信を返す
+func (a *API) Replies() []Reply {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Reply(nil), a.replies...)
+}
+
+// Pushes は成功したプッシュメッセージを返す
+func (a *API) Pushes() []Push {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Push(nil), a.pushes...)
+}
+
+// Multicasts は成功したマルチキャストメッセージを返す
+func (a *API) Multicasts() []Multicast {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Multicast(nil), a.multicasts...)
+}
+
+// Wait は呼び出しが n 件以上記録されるまで待つ
+// Botはイベントを裏側で処理するので、返信を確かめる前にこれで待つ
+func (a *API) Wait(ctx context.Context, n int) ([]Call, error) {
+	for {
+		a.mu.Lock()
+		calls := append([]Call(nil), a.calls...)
+		changed := a.changed
+		a.mu.Unlock()
+		if len(calls) >= n {
+			return calls, nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return calls, ctx.Err()
+		}
+	}
+}
+
+// ServeHTTP は呼び出しを確認して記録する
+// 問題があればLINEのAPIと同じようにエラーのステータスコードとメッセージを返す
+func (a *API) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	call := Call{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Body:   body,
+		Time:   time.Now(),
+		Status: http.StatusOK,
+	}
+
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "Bearer ") {
+		call.Status, call.Error = http.StatusUnauthorized, "Authentication failed due to the following reason: no token. Confirm that the access token in the authorization header is valid."
+	} else {
+		call.Status, call.Error = a.accept(call)
+	}
+	a.record(call)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(call.Status)
+	if call.Error != "" {
+		json.NewEncoder(w).Encode(map[string]string{"message": call.Error})
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+// accept はメッセージを送るAPIの呼び出しを確認して記録する
+func (a *API) accept(call Call) (int, string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch call.Path {
+	case "/v2/bot/message/reply":
+		var reply Reply
+		if err := json.Unmarshal(call.Body, &reply); err != nil {
+			return http.StatusBadRequest, "The request body has 1 error(s): " + err.Error()
+		}
+		if status, message := validateMessages(reply.Messages); status != http.StatusOK {
+			return status, message
+		}
+		token, ok := a.replyTokens[reply.ReplyToken]
+		switch {
+		case !ok:
+			return http.StatusBadRequest, "Invalid reply token"
+		case token.used:
+			return http.StatusBadRequest, "Invalid reply token (already used)"
+		case call.Time.Sub(token.issuedAt) > a.ReplyTokenLifetime:
+			return http.StatusBadRequest, "Invalid reply token (expired)"
+		}
+		token.used = true
+		a.replies = append(a.replies, reply)
+
+	case "/v2/bot/message/push":
+		var push Push
+		if err := json.Unmarshal(call.Body, &push); err != nil {
+			return http.StatusBadRequest, "The request body has 1 error(s): " + err.Error()
+		}
+		if push.To == "" {
+			return http.StatusBadRequest, "The property, 'to', in the request body is invalid"
+		}
+		if status, message := validateMessages(push.Messages); status != http.StatusOK {
+			return status, message
+		}
+		a.pushes = append(a.pushes, push)
+
+	case "/v2/bot/message/multicast":
+		var multicast Multicast
+		if err := json.Unmarshal(call.Body, &multicast); err != nil {
+			return http.StatusBadRequest, "The request body has 1 error(s): " + err.Error()
+		}
+		if len(multicast.To) == 0 || len(multicast.To) > 500 {
+			return http.StatusBadRequest, "The property, 'to', in the request body is invalid"
+		}
+		if status, message := validateMessages(multicast.Messages); status != http.StatusOK {
+			return status, message
+		}
+		a.multicasts = append(a.multicasts, multicast)
+	}
+	return http.StatusOK, ""
+}
+
+// validateMessages はLINEのAPIと同じく、一度に送れるメッセージが1〜5件かを確認する
+func validateMessages(messages []json.RawMessage) (int, string) {
+	if len(messages) == 0 || len(messages) > 5 {
+		return http.StatusBadRequest, fmt.Sprintf("The property, 'messages', in the request body is invalid (%d messages)", len(messages))
+	}
+	for _, message := range messages {
+		if bytes.Equal(bytes.TrimSpace(message), []byte("null")) {
+			return http.StatusBadRequest, "The property, 'messages', in the request body is invalid (null message)"
+		}
+	}
+	return http.StatusOK, ""
+}
+
+func (a *API) record(call Call) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = append(a.calls, call)
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+// AssertMessages は送られたメッセージ got が want と同じJSONになるかを確かめる
+func AssertMessages(t testing.TB, got []json.RawMessage, want ...linebot.SendingMessage) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(got), len(want))
+	}
+	for i := range want {
+		wantJSON, err := json.Marshal(want[i])
+		if err != nil {
+			t.Fatalf("failed to marshal message %d: %v", i, err)
+		}
+		if !equalJSON(got[i], wantJSON) {
+			t.Errorf("message %d:\n got: %s\nwant: %s", i, got[i], wantJSON)
+		}
+	}
+}
+
+// equalJSON はキーの順番や空白の違いを無視してJSONを比べる
+func equalJSON(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return bytes.Equal(ja, jb)
+}
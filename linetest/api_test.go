@@ -0,0 +1,93 @@
+package linetest
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// newClient は api につながったLINEのAPIクライアントを作る
+func newClient(t *testing.T, api *API) *linebot.Client {
+	t.Helper()
+	client, err := linebot.New(ChannelSecret, "linetest-channel-access-token", api.ClientOption())
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return client
+}
+
+// assertRejected は err がLINEのAPIに断られたときのエラーで、message を含むかを確かめる
+func assertRejected(t *testing.T, err error, message string) {
+	t.Helper()
+	var apiErr *linebot.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("got error %v, want *linebot.APIError", err)
+	}
+	if apiErr.Code != http.StatusBadRequest || apiErr.Response.Message != message {
+		t.Errorf("got %d %q, want %d %q", apiErr.Code, apiErr.Response.Message, http.StatusBadRequest, message)
+	}
+}
+
+func TestReplyTokenCanBeUsedOnce(t *testing.T) {
+	api := NewAPI()
+	defer api.Close()
+	client := newClient(t, api)
+	api.IssueReplyToken("token")
+
+	if _, err := client.ReplyMessage("token", linebot.NewTextMessage("1回目")).Do(); err != nil {
+		t.Fatalf("first reply failed: %v", err)
+	}
+	_, err := client.ReplyMessage("token", linebot.NewTextMessage("2回目")).Do()
+	assertRejected(t, err, "Invalid reply token (already used)")
+
+	replies := api.Replies()
+	if len(replies) != 1 {
+		t.Fatalf("got %d replies, want 1", len(replies))
+	}
+	AssertMessages(t, replies[0].Messages, linebot.NewTextMessage("1回目"))
+	if errs := api.Errors(); len(errs) != 1 || errs[0].Path != "/v2/bot/message/reply" {
+		t.Errorf("got errors %+v, want the second reply", errs)
+	}
+}
+
+func TestReplyTokenExpires(t *testing.T) {
+	api := NewAPI()
+	defer api.Close()
+	api.ReplyTokenLifetime = 10 * time.Millisecond
+	client := newClient(t, api)
+	api.IssueReplyToken("token")
+
+	time.Sleep(20 * time.Millisecond)
+	_, err := client.ReplyMessage("token", linebot.NewTextMessage("遅すぎた返信")).Do()
+	assertRejected(t, err, "Invalid reply token (expired)")
+	if replies := api.Replies(); len(replies) != 0 {
+		t.Errorf("got %d replies, want none", len(replies))
+	}
+}
+
+func TestReplyTokenMustBeIssued(t *testing.T) {
+	api := NewAPI()
+	defer api.Close()
+	client := newClient(t, api)
+
+	_, err := client.ReplyMessage("unknown", linebot.NewTextMessage("こんにちは")).Do()
+	assertRejected(t, err, "Invalid reply token")
+}
+
+func TestPushDoesNotNeedReplyToken(t *testing.T) {
+	api := NewAPI()
+	defer api.Close()
+	client := newClient(t, api)
+
+	if _, err := client.PushMessage("Uuser", linebot.NewTextMessage("お知らせ")).Do(); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	pushes := api.Pushes()
+	if len(pushes) != 1 || pushes[0].To != "Uuser" {
+		t.Fatalf("got pushes %+v, want one to Uuser", pushes)
+	}
+	AssertMessages(t, pushes[0].Messages, linebot.NewTextMessage("お知らせ"))
+}
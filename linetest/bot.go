@@ -0,0 +1,92 @@
+package linetest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+)
+
+// ChannelSecret は StartBot で起動したBotのチャネルシークレット
+const ChannelSecret = "linetest-channel-secret"
+
+// Bot はテストの中で起動したBotのサーバと、それにつながった Simulator と API
+type Bot struct {
+	Server    *bot.Server
+	API       *API
+	Simulator *Simulator
+}
+
+// StartBot は偽物のAPIにつながったBotのサーバを起動する
+// setup でサーバに処理を登録する。テストが終わると自動で止まる
+func StartBot(t testing.TB, setup func(server *bot.Server), opts ...bot.Option) *Bot {
+	t.Helper()
+
+	api := NewAPI()
+	t.Cleanup(api.Close)
+
+	opts = append([]bot.Option{bot.WithClientOptions(api.ClientOption())}, opts...)
+	server, err := bot.New(ChannelSecret, "linetest-channel-access-token", opts...)
+	if err != nil {
+		t.Fatalf("failed to create bot server: %v", err)
+	}
+	setup(server)
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("failed to shut down bot server: %v", err)
+		}
+	})
+
+	return &Bot{
+		Server: server,
+		API:    api,
+		Simulator: &Simulator{
+			URL:           httpServer.URL + "/callback",
+			ChannelSecret: ChannelSecret,
+			API:           api,
+		},
+	}
+}
+
+// Send は events を1つのWebhookにまとめて送り、Botが 200 を返したことを確かめる
+func (b *Bot) Send(t testing.TB, events ...*Event) {
+	t.Helper()
+	res, err := b.Simulator.Send(context.Background(), events...)
+	if err != nil {
+		t.Fatalf("failed to send webhook: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		t.Fatalf("webhook returned %s: %s", res.Status, body)
+	}
+}
+
+// SendAndWait は events を送り、Messaging APIの呼び出しが合わせて n 件になるまで待つ
+// 5秒待っても届かなければテストを失敗させる
+func (b *Bot) SendAndWait(t testing.TB, n int, events ...*Event) []Call {
+	t.Helper()
+	b.Send(t, events...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	calls, err := b.API.Wait(ctx, n)
+	if err != nil {
+		t.Fatalf("got %d Messaging API calls, want %d: %v", len(calls), n, err)
+	}
+	for _, call := range calls {
+		if call.Error != "" {
+			t.Errorf("%s %s was rejected: %s", call.Method, call.Path, call.Error)
+		}
+	}
+	return calls
+}
@@ -0,0 +1,206 @@
+// Package linetest はLINEサーバの代わりをしてBotを確かめるための部品をまとめたパッケージ
+//
+// Webhookのイベントを作って署名付きで /callback に送る Simulator と、
+// Botから送られたMessaging APIの呼び出しを確かめて記録する API がある。
+// StartBot を使うと、両方につながったBotをテストの中で起動できる
+package linetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// Event はWebhookで送られるイベントのJSONの形
+type Event struct {
+	Type            linebot.EventType       `json:"type"`
+	Mode            linebot.EventMode       `json:"mode"`
+	Timestamp       int64                   `json:"timestamp"`
+	Source          *linebot.EventSource    `json:"source"`
+	WebhookEventID  string                  `json:"webhookEventId"`
+	DeliveryContext linebot.DeliveryContext `json:"deliveryContext"`
+	ReplyToken      string                  `json:"replyToken,omitempty"`
+	Message         *Message                `json:"message,omitempty"`
+	Postback        *linebot.Postback       `json:"postback,omitempty"`
+	Joined          *linebot.Members        `json:"joined,omitempty"`
+	Left            *linebot.Members        `json:"left,omitempty"`
+}
+
+// Message はWebhookで送られるメッセージのJSONの形
+type Message struct {
+	ID                  string                      `json:"id"`
+	Type                linebot.MessageType         `json:"type"`
+	Text                string                      `json:"text,omitempty"`
+	PackageID           string                      `json:"packageId,omitempty"`
+	StickerID           string                      `json:"stickerId,omitempty"`
+	StickerResourceType linebot.StickerResourceType `json:"stickerResourceType,omitempty"`
+	Title               string                      `json:"title,omitempty"`
+	Address             string                      `json:"address,omitempty"`
+	Latitude            float64                     `json:"latitude,omitempty"`
+	Longitude           float64                     `json:"longitude,omitempty"`
+}
+
+// User は1対1のトークの送信元を作る
+func User(userID string) *linebot.EventSource {
+	return &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: userID}
+}
+
+// Group はグループのトークの送信元を作る
+// userID は送信したメンバーのID
+func Group(groupID, userID string) *linebot.EventSource {
+	return &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: groupID, UserID: userID}
+}
+
+// Room はトークルームの送信元を作る
+func Room(roomID, userID string) *linebot.EventSource {
+	return &linebot.EventSource{Type: linebot.EventSourceTypeRoom, RoomID: roomID, UserID: userID}
+}
+
+// NewEvent は source からのイベントを作る
+// webhookEventId と返信用のトークンはランダムな値になる
+func NewEvent(eventType linebot.EventType, source *linebot.EventSource) *Event {
+	return &Event{
+		Type:           eventType,
+		Mode:           linebot.EventModeActive,
+		Timestamp:      time.Now().UnixMilli(),
+		Source:         source,
+		WebhookEventID: randomID(13),
+		ReplyToken:     randomID(16),
+	}
+}
+
+// TextEvent はテキストメッセージのイベントを作る
+func TextEvent(source *linebot.EventSource, text string) *Event {
+	e := NewEvent(linebot.EventTypeMessage, source)
+	e.Message = &Message{ID: randomID(8), Type: linebot.MessageTypeText, Text: text}
+	return e
+}
+
+// StickerEvent はスタンプのイベントを作る
+func StickerEvent(source *linebot.EventSource, packageID, stickerID string) *Event {
+	e := NewEvent(linebot.EventTypeMessage, source)
+	e.Message = &Message{
+		ID:                  randomID(8),
+		Type:                linebot.MessageTypeSticker,
+		PackageID:           packageID,
+		StickerID:           stickerID,
+		StickerResourceType: linebot.StickerResourceTypeStatic,
+	}
+	return e
+}
+
+// LocationEvent は位置情報のイベントを作る
+func LocationEvent(source *linebot.EventSource, title, address string, latitude, longitude float64) *Event {
+	e := NewEvent(linebot.EventTypeMessage, source)
+	e.Message = &Message{
+		ID:        randomID(8),
+		Type:      linebot.MessageTypeLocation,
+		Title:     title,
+		Address:   address,
+		Latitude:  latitude,
+		Longitude: longitude,
+	}
+	return e
+}
+
+// PostbackEvent はポストバックアクションが押されたイベントを作る
+func PostbackEvent(source *linebot.EventSource, data string) *Event {
+	e := NewEvent(linebot.EventTypePostback, source)
+	e.Postback = &linebot.Postback{Data: data}
+	return e
+}
+
+// FollowEvent は友だち追加のイベントを作る
+func FollowEvent(userID string) *Event {
+	return NewEvent(linebot.EventTypeFollow, User(userID))
+}
+
+// JoinEvent はグループに招待されたイベントを作る
+func JoinEvent(groupID string) *Event {
+	return NewEvent(linebot.EventTypeJoin, &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: groupID})
+}
+
+// Redelivered は再送されたイベントとして印を付ける
+func (e *Event) Redelivered() *Event {
+	e.DeliveryContext.IsRedelivery = true
+	return e
+}
+
+// Sign はチャネルシークレットでリクエストの本文に署名する
+// 結果は X-Line-Signature ヘッダに入れる
+func Sign(channelSecret string, body []byte) string {
+	hash := hmac.New(sha256.New, []byte(channelSecret))
+	hash.Write(body)
+	return base64.StdEncoding.EncodeToString(hash.Sum(nil))
+}
+
+// NewRequest は events を送る署名付きのWebhookのリクエストを作る
+// httptest.NewRecorder と組み合わせれば、サーバを起動せずに Server.ServeHTTP を呼び出せる
+func NewRequest(ctx context.Context, url, channelSecret string, events ...*Event) (*http.Request, error) {
+	body, err := json.Marshal(struct {
+		Destination string   `json:"destination"`
+		Events      []*Event `json:"events"`
+	}{
+		Destination: "Ulinetest",
+		Events:      events,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Line-Signature", Sign(channelSecret, body))
+	return req, nil
+}
+
+// Simulator は起動しているBotのサーバにWebhookを送る
+type Simulator struct {
+	// URL はWebhookを送る先 (例: http://localhost:8080/callback)
+	URL string
+	// ChannelSecret は署名に使うチャネルシークレット
+	ChannelSecret string
+	// Client はリクエストに使うクライアント。nil のときは http.DefaultClient を使う
+	Client *http.Client
+	// API を設定すると、送ったイベントの返信用のトークンをそこで発行したことにする
+	API *API
+}
+
+// Send は events を1つのWebhookにまとめて送る
+func (s *Simulator) Send(ctx context.Context, events ...*Event) (*http.Response, error) {
+	req, err := NewRequest(ctx, s.URL, s.ChannelSecret, events...)
+	if err != nil {
+		return nil, err
+	}
+	if s.API != nil {
+		for _, event := range events {
+			if event.ReplyToken != "" {
+				s.API.IssueReplyToken(event.ReplyToken)
+			}
+		}
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// randomID はランダムな16進数の文字列を作る
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,41 @@
+// Package omikuji はおみくじ機能
+package omikuji
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// init関数はパッケージが読み込まれたときに呼び出される
+func init() {
+	// ランダムな数値を生成する際のシード値の設定
+	rand.Seed(time.Now().UnixNano())
+}
+
+// おみくじの結果の一覧
+var oracles = []string{
+	"大吉",
+	"中吉",
+	"小吉",
+	"末吉",
+	"吉",
+	"凶",
+	"末凶",
+	"小凶",
+	"中凶",
+	"大凶",
+}
+
+// Draw はおみくじ結果を生成する
+func Draw() string {
+	// rand.Intn(10)は0～9のランダムな整数を返す
+	return oracles[rand.Intn(len(oracles))]
+}
+
+// Handler はおみくじ結果を返信する
+func Handler(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	return linebot.NewTextMessage(Draw())
+}
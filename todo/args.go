@@ -0,0 +1,96 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// 引数を囲む引用符と、それを閉じる引用符
+// スマートフォンのキーボードでは " が “ ” に変わることがあるので、それも引用符として扱う
+var quotes = map[rune]rune{
+	'"':  '"',
+	'\'': '\'',
+	'“':  '”',
+	'「':  '」',
+	'『':  '』',
+}
+
+// splitArgs はメッセージをシェルのように引数に区切る
+//
+// 空白(全角スペースを含む)がいくつ続いても1つの区切りとして扱う。
+// 引数の始めに引用符があるときは、閉じる引用符までを空白ごと1つの引数にする (例: "英語 レポート")。
+// 引数の途中にある引用符 (don't など) はそのまま文字として扱う
+func splitArgs(text string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	// inArg は引数を読んでいる途中かどうか。"" のような空の引数も1つと数えるために使う
+	inArg := false
+	// closing は閉じる引用符。引用符の中にいないときは 0
+	var closing rune
+	for _, r := range text {
+		switch {
+		case closing != 0:
+			if r == closing {
+				closing = 0
+				continue
+			}
+			arg.WriteRune(r)
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case !inArg && quotes[r] != 0:
+			closing = quotes[r]
+			inArg = true
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if closing != 0 {
+		return nil, errors.New("引用符が閉じられていないよ\n例: todo add \"英語 レポート\" 2/24")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// normalizeText は全角の英数字と記号を半角にし、小文字にして、空白を1つにまとめる
+// 期限・優先度・タグ・一覧の条件など、言葉の書き方の違いを吸収して比べるときに使う
+func normalizeText(text string) string {
+	mapped := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '！' && r <= '～':
+			return r - '！' + '!'
+		case r == '　':
+			return ' '
+		}
+		return r
+	}, text)
+	return strings.Join(strings.FieldsFunc(strings.ToLower(mapped), unicode.IsSpace), " ")
+}
+
+// subcommand はTodoListの操作 (「todo」に続けて入力するもの)
+type subcommand struct {
+	// usage は使い方。引数の数が合わないときに返す
+	usage string
+	// minArgs, maxArgs は受け付ける引数の数。maxArgs が -1 のときは上限なし
+	minArgs, maxArgs int
+	// run は操作を実行して返信するメッセージを返す。args は操作の名前より後の引数
+	run func(s *Service, ctx context.Context, source *linebot.EventSource, args []string) string
+}
+
+// validate は引数の数が合っているかを確かめ、合わなければ使い方を返す
+func (c subcommand) validate(args []string) (string, bool) {
+	if len(args) < c.minArgs || (c.maxArgs >= 0 && len(args) > c.maxArgs) {
+		return "使い方: " + c.usage, false
+	}
+	return "", true
+}
@@ -0,0 +1,77 @@
+package todo
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"todo list", []string{"todo", "list"}},
+		// 空白がいくつ続いても1つの区切り
+		{"  todo   add  宿題 明日 ", []string{"todo", "add", "宿題", "明日"}},
+		// 全角スペースも区切り
+		{"todo　add　宿題　明日", []string{"todo", "add", "宿題", "明日"}},
+		// 引用符で囲むと空白ごと1つの引数
+		{`todo add "英語 レポート" 2/24`, []string{"todo", "add", "英語 レポート", "2/24"}},
+		{"todo add 「英語　レポート」 2/24", []string{"todo", "add", "英語　レポート", "2/24"}},
+		{"todo add “英語 レポート” 2/24", []string{"todo", "add", "英語 レポート", "2/24"}},
+		{"todo add 『a』'b c'", []string{"todo", "add", "a'b", "c'"}},
+		// 空の引数も1つと数える
+		{`todo edit 1 名前 ""`, []string{"todo", "edit", "1", "名前", ""}},
+		// 引数の途中の引用符は文字
+		{"todo add don't 明日", []string{"todo", "add", "don't", "明日"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.text)
+		if err != nil {
+			t.Errorf("splitArgs(%q): %v", tt.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSplitArgsRejectsUnclosedQuote(t *testing.T) {
+	for _, text := range []string{`todo add "英語 レポート 2/24`, "todo add 「宿題 明日", `todo add "a" "b`} {
+		if got, err := splitArgs(text); err == nil {
+			t.Errorf("splitArgs(%q) = %q, want an error", text, got)
+		}
+	}
+}
+
+// 引数の数が合わないときは、データベースを使う前に使い方を返す
+func TestDealReturnsUsage(t *testing.T) {
+	var s Service
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"todo", HelpMessage},
+		{"todo unknown", HelpMessage},
+		{"todo add 宿題", "使い方: " + addUsage},
+		{"todo done", `使い方: todo done "タスクID"`},
+		{"todo done 1 2", `使い方: todo done "タスクID"`},
+		{"todo edit 1 名前", "使い方: " + editUsage},
+		{"todo undo 1", "使い方: todo undo"},
+		{`todo timezone Asia/Tokyo UTC`, `使い方: todo timezone "タイムゾーン"`},
+		// 操作の名前は大文字でもよい
+		{"todo DONE", `使い方: todo done "タスクID"`},
+	}
+	for _, tt := range tests {
+		if got := s.Deal(context.Background(), nil, tt.text); got != tt.want {
+			t.Errorf("Deal(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+	if got := s.Deal(context.Background(), nil, `todo add "宿題`); !strings.HasPrefix(got, "引用符が閉じられていないよ") {
+		t.Errorf("got %q, want the unclosed quote error", got)
+	}
+}
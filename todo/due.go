@@ -0,0 +1,242 @@
+package todo
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Due はTodoの期限
+type Due struct {
+	// Time は期限の日時
+	// 時刻を指定しなかったときはその日の終わり (23:59:59) にする
+	Time time.Time
+	// HasTime は時刻まで指定したかどうか
+	HasTime bool
+}
+
+var weekdays = [...]string{"日", "月", "火", "水", "木", "金", "土"}
+
+// String は期限を「2023/2/24(金) 18:00」の形にする。時刻を指定しなかったときは日付だけにする
+func (d Due) String() string {
+	s := fmt.Sprintf("%d/%d/%d(%s)", d.Time.Year(), d.Time.Month(), d.Time.Day(), weekdays[d.Time.Weekday()])
+	if d.HasTime {
+		s += d.Time.Format(" 15:04")
+	}
+	return s
+}
+
+// 期限の書き方の例
+const dueExamples = "今日, 明日 18:00, 3日後, 来週金曜, 2/24, 2023-02-24 9:30, tomorrow 6pm, next fri"
+
+// 時刻の書き方
+var (
+	// 18:00, 6:30pm
+	clockPattern = regexp.MustCompile(`(\d{1,2}):(\d{2})\s*(am|pm)?`)
+	// 午後6時, 18時半, 9時15分
+	japaneseTimePattern = regexp.MustCompile(`(午前|午後)?(\d{1,2})時(半|(\d{1,2})分)?`)
+	// 6pm, 9 am
+	ampmPattern = regexp.MustCompile(`(\d{1,2})\s*(am|pm)`)
+	// 正午, noon (afternoon の中の noon は含めない)
+	noonPattern = regexp.MustCompile(`正午|\bnoon\b`)
+)
+
+// 日付の書き方
+var (
+	// 2023-02-24, 2023/2/24
+	isoDatePattern = regexp.MustCompile(`^(\d{4})[-/](\d{1,2})[-/](\d{1,2})$`)
+	// 2023年2月24日
+	japaneseFullDatePattern = regexp.MustCompile(`^(\d{4})年(\d{1,2})月(\d{1,2})日$`)
+	// 2/24
+	monthDayPattern = regexp.MustCompile(`^(\d{1,2})/(\d{1,2})$`)
+	// 2月24日
+	japaneseDatePattern = regexp.MustCompile(`^(\d{1,2})月(\d{1,2})日$`)
+	// 3日後, in 3 days
+	daysLaterPattern = regexp.MustCompile(`^(?:(\d+)日後|in (\d+) days?)$`)
+	// 2週間後, in 2 weeks
+	weeksLaterPattern = regexp.MustCompile(`^(?:(\d+)週間後|in (\d+) weeks?)$`)
+	// 来週金曜, 金曜日, 今週の金曜
+	japaneseWeekdayPattern = regexp.MustCompile(`^(今週|来週|再来週)?の?([日月火水木金土])曜日?$`)
+	// next friday, fri, tues (monkey や sunny のような言葉は含めない)
+	englishWeekdayPattern = regexp.MustCompile(`^(this |next )?(sunday|monday|tuesday|wednesday|thursday|friday|saturday|sun|mon|tues?|wed|thu(?:rs?)?|fri|sat)$`)
+)
+
+// 今日からの日数で表す言葉
+var relativeDays = map[string]int{
+	"今日": 0, "きょう": 0, "本日": 0, "today": 0, "tonight": 0,
+	"明日": 1, "あした": 1, "あす": 1, "tomorrow": 1,
+	"明後日": 2, "あさって": 2,
+}
+
+var englishWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseDue は「明日 18:00」「来週金曜」「2/24」「tomorrow 6pm」のような期限を now から見た日時にする
+//
+// 日付と時刻はどちらを省いてもよい。日付を省いたときは今日 (時刻が過ぎていれば明日)、
+// 時刻を省いたときはその日の終わりにする。年を省いた日付が過ぎていれば来年にする。
+// 日時は now のタイムゾーンで数える
+func ParseDue(text string, now time.Time) (Due, error) {
+	s := normalizeText(text)
+	if s == "" {
+		return Due{}, fmt.Errorf("期限が空だよ")
+	}
+
+	hour, minute, rest, hasTime, err := extractTime(s)
+	if err != nil {
+		return Due{}, err
+	}
+	date, ok := parseDate(strings.TrimSpace(rest), now)
+	if !ok {
+		return Due{}, fmt.Errorf("「%s」は期限として読めなかったよ\n例: %s", text, dueExamples)
+	}
+
+	// 夏時間のあるタイムゾーンでも時計の時刻がずれないように、0時からの時間を足さずに日時をつくる
+	y, m, d := date.Date()
+	if !hasTime {
+		return Due{Time: time.Date(y, m, d, 23, 59, 59, 0, now.Location())}, nil
+	}
+	due := time.Date(y, m, d, hour, minute, 0, 0, now.Location())
+	// 「18:00」だけのときにもう過ぎていれば明日の18:00にする
+	if strings.TrimSpace(rest) == "" && due.Before(now) {
+		due = time.Date(y, m, d+1, hour, minute, 0, 0, now.Location())
+	}
+	return Due{Time: due, HasTime: true}, nil
+}
+
+// extractTime は s から時刻を取り出し、残りの文字列と一緒に返す
+func extractTime(s string) (hour, minute int, rest string, ok bool, err error) {
+	if noonPattern.MatchString(s) {
+		return 12, 0, noonPattern.ReplaceAllString(s, ""), true, nil
+	}
+	var ampm string
+	var loc []int
+	if m := clockPattern.FindStringSubmatchIndex(s); m != nil {
+		loc = m
+		hour, _ = strconv.Atoi(s[m[2]:m[3]])
+		minute, _ = strconv.Atoi(s[m[4]:m[5]])
+		if m[6] >= 0 {
+			ampm = s[m[6]:m[7]]
+		}
+	} else if m := japaneseTimePattern.FindStringSubmatchIndex(s); m != nil {
+		loc = m
+		hour, _ = strconv.Atoi(s[m[4]:m[5]])
+		if m[2] >= 0 && s[m[2]:m[3]] == "午後" {
+			ampm = "pm"
+		} else if m[2] >= 0 {
+			ampm = "am"
+		}
+		switch {
+		case m[8] >= 0:
+			minute, _ = strconv.Atoi(s[m[8]:m[9]])
+		case m[6] >= 0:
+			minute = 30
+		}
+	} else if m := ampmPattern.FindStringSubmatchIndex(s); m != nil {
+		loc = m
+		hour, _ = strconv.Atoi(s[m[2]:m[3]])
+		ampm = s[m[4]:m[5]]
+	} else {
+		return 0, 0, s, false, nil
+	}
+
+	// 午前・午後を付けたときは12時まで
+	if hour > 23 || minute > 59 || (ampm != "" && hour > 12) {
+		return 0, 0, "", false, fmt.Errorf("「%s」は時刻として読めなかったよ", s[loc[0]:loc[1]])
+	}
+	switch ampm {
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+	return hour, minute, s[:loc[0]] + " " + s[loc[1]:], true, nil
+}
+
+// parseDate は日付を表す s を now のタイムゾーンでのその日の0時にする
+// s が空のときは今日にする
+func parseDate(s string, now time.Time) (time.Time, bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if s == "" {
+		return today, true
+	}
+	if days, ok := relativeDays[s]; ok {
+		return today.AddDate(0, 0, days), true
+	}
+	if m := daysLaterPattern.FindStringSubmatch(s); m != nil {
+		return today.AddDate(0, 0, atoi(m[1]+m[2])), true
+	}
+	if m := weeksLaterPattern.FindStringSubmatch(s); m != nil {
+		return today.AddDate(0, 0, 7*atoi(m[1]+m[2])), true
+	}
+	if s == "月末" || s == "end of month" {
+		return time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, now.Location()), true
+	}
+	if m := isoDatePattern.FindStringSubmatch(s); m != nil {
+		return date(atoi(m[1]), atoi(m[2]), atoi(m[3]), now.Location())
+	}
+	if m := japaneseFullDatePattern.FindStringSubmatch(s); m != nil {
+		return date(atoi(m[1]), atoi(m[2]), atoi(m[3]), now.Location())
+	}
+	for _, pattern := range []*regexp.Regexp{monthDayPattern, japaneseDatePattern} {
+		if m := pattern.FindStringSubmatch(s); m != nil {
+			d, ok := date(now.Year(), atoi(m[1]), atoi(m[2]), now.Location())
+			// 年を省いた日付がもう過ぎていれば来年にする
+			if ok && d.Before(today) {
+				d, ok = date(now.Year()+1, atoi(m[1]), atoi(m[2]), now.Location())
+			}
+			return d, ok
+		}
+	}
+	if m := japaneseWeekdayPattern.FindStringSubmatch(s); m != nil {
+		weeks := map[string]int{"今週": 0, "来週": 1, "再来週": 2}
+		for i, w := range weekdays {
+			if w == m[2] {
+				return weekday(today, time.Weekday(i), m[1] != "", weeks[m[1]]), true
+			}
+		}
+	}
+	if m := englishWeekdayPattern.FindStringSubmatch(s); m != nil {
+		w := englishWeekdays[m[2][:3]]
+		switch m[1] {
+		case "next ":
+			return weekday(today, w, true, 1), true
+		case "this ":
+			return weekday(today, w, true, 0), true
+		}
+		return weekday(today, w, false, 0), true
+	}
+	return time.Time{}, false
+}
+
+// weekday は today から見た曜日 w の日付を返す
+// inWeek が true のときは、今週 (月曜から日曜まで) から weeks 週後のその曜日にする
+// false のときは、今日を含めて次に来るその曜日にする
+func weekday(today time.Time, w time.Weekday, inWeek bool, weeks int) time.Time {
+	if !inWeek {
+		return today.AddDate(0, 0, (int(w)-int(today.Weekday())+7)%7)
+	}
+	// 月曜を週の始めとして数える
+	offset := func(d time.Weekday) int { return (int(d) + 6) % 7 }
+	monday := today.AddDate(0, 0, -offset(today.Weekday()))
+	return monday.AddDate(0, 0, 7*weeks+offset(w))
+}
+
+// date は年月日が正しい日付ならその日の0時を返す (2/30 などは false)
+func date(year, month, day int, loc *time.Location) (time.Time, bool) {
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc)
+	return t, t.Month() == time.Month(month) && t.Day() == day
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,99 @@
+package todo
+
+import (
+	"testing"
+	"time"
+)
+
+var jst = time.FixedZone("JST", 9*60*60)
+
+func TestParseDue(t *testing.T) {
+	// 2023/2/24 は金曜日
+	now := time.Date(2023, 2, 24, 10, 0, 0, 0, jst)
+	endOfDay := func(month time.Month, day int) time.Time {
+		return time.Date(2023, month, day, 23, 59, 59, 0, jst)
+	}
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2023, month, day, hour, minute, 0, 0, jst)
+	}
+	tests := []struct {
+		text    string
+		want    time.Time
+		hasTime bool
+	}{
+		// 今日からの日数
+		{"今日", endOfDay(2, 24), false},
+		{"明日 18:00", at(2, 25, 18, 0), true},
+		{"あさって", endOfDay(2, 26), false},
+		{"3日後", endOfDay(2, 27), false},
+		{"in 2 weeks", endOfDay(3, 10), false},
+		// 年を省いた日付は、過ぎていれば来年にする
+		{"2/24", endOfDay(2, 24), false},
+		{"2/1", time.Date(2024, 2, 1, 23, 59, 59, 0, jst), false},
+		{"12月31日", endOfDay(12, 31), false},
+		{"2023-03-01 9:30", at(3, 1, 9, 30), true},
+		// 曜日
+		{"金曜", endOfDay(2, 24), false},
+		{"今週の月曜日", endOfDay(2, 20), false},
+		{"来週金曜", endOfDay(3, 3), false},
+		{"friday", endOfDay(2, 24), false},
+		{"next tues", endOfDay(2, 28), false},
+		// 午前・午後
+		{"tomorrow 6pm", at(2, 25, 18, 0), true},
+		{"明日 12am", at(2, 25, 0, 0), true},
+		{"午後3時半", at(2, 24, 15, 30), true},
+		{"6:30 pm", at(2, 24, 18, 30), true},
+		// 時刻だけでもう過ぎていれば明日にする
+		{"9:00", at(2, 25, 9, 0), true},
+		// 正午
+		{"明日 正午", at(2, 25, 12, 0), true},
+		{"tomorrow noon", at(2, 25, 12, 0), true},
+		// 全角の英数字
+		{"明日　１８：００", at(2, 25, 18, 0), true},
+	}
+	for _, tt := range tests {
+		due, err := ParseDue(tt.text, now)
+		if err != nil {
+			t.Errorf("ParseDue(%q): %v", tt.text, err)
+			continue
+		}
+		if !due.Time.Equal(tt.want) || due.HasTime != tt.hasTime {
+			t.Errorf("ParseDue(%q) = %v (hasTime %v), want %v (hasTime %v)", tt.text, due.Time, due.HasTime, tt.want, tt.hasTime)
+		}
+	}
+}
+
+func TestParseDueRejectsInvalidText(t *testing.T) {
+	now := time.Date(2023, 2, 24, 10, 0, 0, 0, jst)
+	for _, text := range []string{"", "いつか", "monkey", "sunny", "tomorrow afternoon", "2/30", "25:00", "午後13時"} {
+		if due, err := ParseDue(text, now); err == nil {
+			t.Errorf("ParseDue(%q) = %v, want an error", text, due)
+		}
+	}
+}
+
+// 夏時間が始まる日も、期限は時計の時刻どおりにする
+func TestParseDueOnDSTChange(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("タイムゾーンの情報がない: %v", err)
+	}
+	// 2023/3/12 の2時に夏時間が始まる
+	now := time.Date(2023, 3, 11, 10, 0, 0, 0, newYork)
+	tests := []struct {
+		text string
+		want time.Time
+	}{
+		{"明日", time.Date(2023, 3, 12, 23, 59, 59, 0, newYork)},
+		{"明日 18:00", time.Date(2023, 3, 12, 18, 0, 0, 0, newYork)},
+	}
+	for _, tt := range tests {
+		due, err := ParseDue(tt.text, now)
+		if err != nil {
+			t.Fatalf("ParseDue(%q): %v", tt.text, err)
+		}
+		if !due.Time.Equal(tt.want) {
+			t.Errorf("ParseDue(%q) = %v, want %v", tt.text, due.Time, tt.want)
+		}
+	}
+}
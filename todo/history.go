@@ -0,0 +1,168 @@
+package todo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+)
+
+// Todoへの変更の履歴を保存するテーブル
+// 「todo undo」で元に戻せるように、変更する前のTodoの値を保存する
+const createHistoryTable = `CREATE TABLE IF NOT EXISTS todo_history (
+	id INT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	owner_id VARCHAR(64) NOT NULL,
+	user_id VARCHAR(64) NOT NULL,
+	task_id INT UNSIGNED NOT NULL,
+	operation VARCHAR(16) NOT NULL,
+	todo VARCHAR(255) NOT NULL,
+	due_date VARCHAR(255) NOT NULL,
+	due_at DATETIME NULL,
+	due_has_time BOOLEAN NOT NULL DEFAULT FALSE,
+	status VARCHAR(16) NOT NULL,
+	completed_at DATETIME NULL,
+	priority TINYINT NOT NULL DEFAULT 2,
+	INDEX (owner_id, user_id)
+)`
+
+// historyLimit はユーザーごとに元に戻せる変更の数
+const historyLimit = 20
+
+// Todoへの変更の種類
+const (
+	opAdd    = "add"
+	opEdit   = "edit"
+	opDone   = "done"
+	opCancel = "cancel"
+)
+
+// 返信で使う変更の種類の名前
+var operationLabels = map[string]string{
+	opAdd:    "追加",
+	opEdit:   "変更",
+	opDone:   "完了",
+	opCancel: "取り消し",
+}
+
+// operation は状態を status (完了か取り消し) にする変更の種類を返す
+func operation(status Status) string {
+	if status == StatusCancelled {
+		return opCancel
+	}
+	return opDone
+}
+
+// change は履歴を残してから update でTodoを変更する
+// before は変更する前のTodoで、「todo undo」でこの値に戻す
+func (s *Service) change(ctx context.Context, source *linebot.EventSource, op string, before Task, update func(tx *sqlx.Tx) error) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := record(ctx, tx, source, op, before); err != nil {
+		return err
+	}
+	if err := update(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// record は source のユーザーが task に op の変更をしたことを履歴に残す
+// 古い履歴はユーザーごとに historyLimit 件まで残して削除する
+func record(ctx context.Context, db sqlx.ExecerContext, source *linebot.EventSource, op string, task Task) error {
+	ownerID := bot.SourceID(source)
+	_, err := db.ExecContext(ctx, `INSERT INTO todo_history (owner_id, user_id, task_id, operation, todo, due_date, due_at, due_has_time, status, completed_at, priority)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		ownerID, source.UserID, task.ID, op, task.Todo, task.DueDate, task.DueAt, task.DueHasTime, task.Status, task.CompletedAt, task.Priority)
+	if err != nil {
+		return err
+	}
+	// MySQLでは削除するテーブルを副問い合わせで使えないので、もう1段包む
+	_, err = db.ExecContext(ctx, `DELETE FROM todo_history WHERE owner_id = ? AND user_id = ? AND id NOT IN (
+		SELECT id FROM (SELECT id FROM todo_history WHERE owner_id = ? AND user_id = ? ORDER BY id DESC LIMIT ?) recent)`,
+		ownerID, source.UserID, ownerID, source.UserID, historyLimit)
+	return err
+}
+
+// updateTask は task のタスク名・期限・状態・優先度を保存する
+func updateTask(ctx context.Context, db sqlx.ExecerContext, task Task) error {
+	_, err := db.ExecContext(ctx, "UPDATE tasks SET todo = ?, due_date = ?, due_at = ?, due_has_time = ?, status = ?, completed_at = ?, priority = ? WHERE id = ? AND owner_id = ?",
+		task.Todo, task.DueDate, task.DueAt, task.DueHasTime, task.Status, task.CompletedAt, task.Priority, task.ID, task.OwnerID)
+	return err
+}
+
+// history は履歴に残した変更
+type history struct {
+	HistoryID uint   `db:"history_id"`
+	Operation string `db:"operation"`
+	// Task は変更する前のTodo
+	Task
+}
+
+// 最後にした変更を元に戻す
+// グループでは他の人の変更を戻さないように、送ったユーザー自身の変更だけを戻す
+func (s *Service) undo(ctx context.Context, source *linebot.EventSource, _ []string) string {
+	if source.UserID == "" {
+		return "ユーザーがわからないので元に戻せないよ"
+	}
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return "Botサーバーでエラーが発生しました"
+	}
+	defer tx.Rollback()
+
+	var last history
+	err = tx.GetContext(ctx, &last, `SELECT id AS history_id, operation, task_id AS id, todo, due_date, due_at, due_has_time, owner_id, status, completed_at, priority
+		FROM todo_history WHERE owner_id = ? AND user_id = ? ORDER BY id DESC LIMIT 1 FOR UPDATE`, bot.SourceID(source), source.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "元に戻せる変更はないよ"
+	}
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return "Botサーバーでエラーが発生しました"
+	}
+
+	// 追加を戻すときはTodoを削除し、それ以外は変更する前の値に戻す
+	if last.Operation == opAdd {
+		_, err = tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = ? AND owner_id = ?", last.ID, last.OwnerID)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "DELETE FROM todo_reminders WHERE task_id = ?", last.ID)
+		}
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "DELETE FROM todo_tags WHERE task_id = ?", last.ID)
+		}
+	} else {
+		err = updateTask(ctx, tx, last.Task)
+		if err == nil {
+			err = syncTags(ctx, tx, last.ID, last.Todo)
+		}
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, "DELETE FROM todo_history WHERE id = ?", last.HistoryID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return "Botサーバーでエラーが発生しました"
+	}
+
+	// 期限を戻したときは、リマインダーも戻した期限で登録し直す
+	if last.Operation == opEdit {
+		if _, err := s.rescheduleReminders(ctx, last.Task, time.Now()); err != nil {
+			log.Printf("db error: %v", err)
+		}
+	}
+	return fmt.Sprintf("ID:%dのTodo「%s」の%sを元に戻したよ", last.ID, last.Todo, operationLabels[last.Operation])
+}
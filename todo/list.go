@@ -0,0 +1,196 @@
+package todo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+)
+
+// todo list の使い方
+const listUsage = `todo list [today|overdue|#タグ|priority:high|page:2]`
+
+// 「todo list」の1ページに表示する文字数の上限
+// テキストメッセージは5000文字までなので、見出しと案内の分を残しておく
+const pageLength = 4500
+
+// listFilter は「todo list」で表示するTodoの条件
+type listFilter struct {
+	// today は今日が期限のTodoだけを表示する
+	today bool
+	// overdue は期限を過ぎたTodoだけを表示する
+	overdue bool
+	// tags はすべてのタグが付いたTodoだけを表示する
+	tags []string
+	// priority はその優先度のTodoだけを表示する。0のときはすべて
+	priority Priority
+	// page は表示するページ (1から)
+	page int
+	// words はページ以外の条件の引数。次のページを表示するコマンドの案内に使う
+	words []string
+}
+
+// 条件を表す言葉
+var (
+	todayWords   = []string{"today", "今日", "きょう"}
+	overdueWords = []string{"overdue", "期限切れ"}
+	// page:2, 2ページ
+	pagePattern = regexp.MustCompile(`^(?:page:(\d+)|(\d+)ページ)$`)
+)
+
+// parseListFilter は「todo list」の引数を条件として読み取る
+func parseListFilter(args []string) (listFilter, error) {
+	filter := listFilter{page: 1}
+	for _, arg := range args {
+		word := normalizeText(arg)
+		if m := pagePattern.FindStringSubmatch(word); m != nil {
+			filter.page = atoi(m[1] + m[2])
+			if filter.page < 1 {
+				return listFilter{}, fmt.Errorf("ページは1から数えてね")
+			}
+			continue
+		}
+		switch {
+		case contains(todayWords, word):
+			filter.today = true
+		case contains(overdueWords, word):
+			filter.overdue = true
+		case strings.HasPrefix(word, "#"):
+			tag := normalizeTag(word)
+			if tag == "" {
+				return listFilter{}, fmt.Errorf("タグの名前がないよ\n使い方: %s", listUsage)
+			}
+			filter.tags = append(filter.tags, tag)
+		default:
+			priority, ok := parsePriorityArg(word)
+			if !ok {
+				return listFilter{}, fmt.Errorf("「%s」は条件として読めなかったよ\n使い方: %s", arg, listUsage)
+			}
+			filter.priority = priority
+		}
+		filter.words = append(filter.words, arg)
+	}
+	return filter, nil
+}
+
+func contains(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+// where は ownerID のTodoListで条件に合うまだ終わっていないTodoを選ぶ WHERE 句とその引数を返す
+// 今日や期限切れは now のタイムゾーンで数える
+func (f listFilter) where(ownerID string, now time.Time) (string, []interface{}) {
+	conditions := []string{"owner_id = ?", "status = ?"}
+	args := []interface{}{ownerID, StatusOpen}
+	if f.today {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		conditions = append(conditions, "due_at >= ? AND due_at < ?")
+		args = append(args, today, today.AddDate(0, 0, 1))
+	}
+	if f.overdue {
+		conditions = append(conditions, "due_at < ?")
+		args = append(args, now)
+	}
+	for _, tag := range f.tags {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM todo_tags WHERE todo_tags.task_id = tasks.id AND todo_tags.tag = ?)")
+		args = append(args, tag)
+	}
+	if f.priority != 0 {
+		conditions = append(conditions, "priority = ?")
+		args = append(args, f.priority)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// nextCommand は次のページを表示するコマンド
+func (f listFilter) nextCommand() string {
+	words := []string{"todo", "list"}
+	for _, w := range f.words {
+		if strings.ContainsAny(w, " 　") {
+			w = `"` + w + `"`
+		}
+		words = append(words, w)
+	}
+	return strings.Join(append(words, fmt.Sprintf("page:%d", f.page+1)), " ")
+}
+
+// Todoリストの取得
+// 「todo list today #レポート」のように条件を付けると、そのTodoだけを表示する
+// 期限の近い順 (期限のないものは最後)、同じ期限なら優先度の高い順に並べ、長いときはページに分ける
+func (s *Service) getTodoList(ctx context.Context, source *linebot.EventSource, args []string) string {
+	filter, err := parseListFilter(args)
+	if err != nil {
+		return err.Error()
+	}
+	ownerID := bot.SourceID(source)
+	loc := s.Location(ctx, ownerID)
+	now := time.Now().In(loc)
+
+	// MySQLデータベースへのクエリを発行して、送信元のTodoListのまだ終わっていないTodoの一覧を取得する
+	where, params := filter.where(ownerID, now)
+	var tasks []Task
+	err = s.db.SelectContext(ctx, &tasks, "SELECT "+taskColumns+" FROM tasks WHERE "+where+" ORDER BY due_at IS NULL, due_at, priority DESC, id", params...)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return "Botサーバーでエラーが発生しました"
+	}
+
+	// メッセージの生成
+	replyMessage := "ID/ToDo/期限/優先度"
+	if len(tasks) == 0 && len(filter.words) > 0 {
+		return replyMessage + "\n条件に合うTodoはないよ"
+	}
+	lines := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		line := fmt.Sprintf("%d/%v/%v/%v", task.ID, task.Todo, task.dueText(loc), task.Priority)
+		if task.DueAt.Valid && task.DueAt.Time.Before(now) {
+			line += " ⚠期限切れ"
+		}
+		lines = append(lines, line)
+	}
+	pages := paginate(lines, pageLength)
+	if filter.page > len(pages) {
+		return fmt.Sprintf("ページは%dまでだよ", len(pages))
+	}
+	for _, line := range pages[filter.page-1] {
+		replyMessage += "\n" + line
+	}
+	if len(pages) > 1 {
+		replyMessage += fmt.Sprintf("\n(%d/%dページ)", filter.page, len(pages))
+		if filter.page < len(pages) {
+			replyMessage += fmt.Sprintf("\n続きは「%s」", filter.nextCommand())
+		}
+	}
+	return replyMessage
+}
+
+// paginate は行を1ページの文字数が length 以下になるように分ける
+// 行がないときも空のページを1つ返す
+func paginate(lines []string, length int) [][]string {
+	pages := [][]string{nil}
+	size := 0
+	for _, line := range lines {
+		n := utf8.RuneCountInString(line) + 1
+		last := len(pages) - 1
+		if size+n > length && len(pages[last]) > 0 {
+			pages = append(pages, nil)
+			last++
+			size = 0
+		}
+		pages[last] = append(pages[last], line)
+		size += n
+	}
+	return pages
+}
@@ -0,0 +1,112 @@
+package todo
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Priority はTodoの優先度
+// 大きいほど優先度が高く、一覧では期限が同じなら優先度の高いものを先に表示する
+type Priority int
+
+const (
+	// PriorityLow は優先度「低」
+	PriorityLow Priority = 1
+	// PriorityMedium は優先度「中」。指定しなかったときはこれにする
+	PriorityMedium Priority = 2
+	// PriorityHigh は優先度「高」
+	PriorityHigh Priority = 3
+)
+
+// 優先度を表す言葉
+var priorityWords = map[string]Priority{
+	"高": PriorityHigh, "high": PriorityHigh, "h": PriorityHigh,
+	"中": PriorityMedium, "medium": PriorityMedium, "mid": PriorityMedium, "m": PriorityMedium, "normal": PriorityMedium,
+	"低": PriorityLow, "low": PriorityLow, "l": PriorityLow,
+}
+
+// String は優先度を「高」「中」「低」で返す
+func (p Priority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "高"
+	case PriorityLow:
+		return "低"
+	}
+	return "中"
+}
+
+// ParsePriority は「高」「high」などの言葉を優先度にする
+func ParsePriority(word string) (Priority, bool) {
+	p, ok := priorityWords[normalizeText(word)]
+	return p, ok
+}
+
+// parsePriorityArg は「!高」「priority:high」「優先度:高」の形の引数を優先度として読み取る
+// 優先度を表す引数でないときは false を返す
+func parsePriorityArg(arg string) (Priority, bool) {
+	s := normalizeText(arg)
+	for _, prefix := range []string{"!", "priority:", "優先度:", "p:"} {
+		if strings.HasPrefix(s, prefix) {
+			return ParsePriority(strings.TrimPrefix(s, prefix))
+		}
+	}
+	return 0, false
+}
+
+// タスク名の中のタグ (例: #レポート)
+// 「C#」のように単語の途中にある # はタグにしない
+// Go の正規表現の \s は半角の空白だけなので、全角スペース (U+3000) も区切りとして並べる
+var tagPattern = regexp.MustCompile(`(?:^|[\s\x{3000}])[#＃]([^\s\x{3000}#＃]+)`)
+
+// Todoのタグを保存するテーブル
+// タグはタスク名から読み取るので、タスク名を変えたときは syncTags で保存し直す
+const createTagsTable = `CREATE TABLE IF NOT EXISTS todo_tags (
+	task_id INT UNSIGNED NOT NULL,
+	tag VARCHAR(64) NOT NULL,
+	PRIMARY KEY (task_id, tag),
+	INDEX (tag)
+)`
+
+// maxTagLength はタグの最大の文字数
+const maxTagLength = 64
+
+// normalizeTag はタグを比べやすいように、全角の英数字を半角にして小文字にする
+func normalizeTag(tag string) string {
+	return strings.TrimLeft(normalizeText(tag), "#")
+}
+
+// Tags はタスク名 title に含まれるタグを、重複を除いて出てきた順に返す
+func Tags(title string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, m := range tagPattern.FindAllStringSubmatch(title, -1) {
+		tag := normalizeTag(m[1])
+		// todo_tags の tag 列に収まるように切り詰める
+		if runes := []rune(tag); len(runes) > maxTagLength {
+			tag = string(runes[:maxTagLength])
+		}
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// syncTags は taskID のTodoのタグを、タスク名 title に含まれるタグで保存し直す
+func syncTags(ctx context.Context, db sqlx.ExecerContext, taskID uint, title string) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM todo_tags WHERE task_id = ?", taskID); err != nil {
+		return err
+	}
+	for _, tag := range Tags(title) {
+		if _, err := db.ExecContext(ctx, "INSERT INTO todo_tags (task_id, tag) VALUES (?, ?)", taskID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
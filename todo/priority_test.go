@@ -0,0 +1,26 @@
+package todo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	tests := []struct {
+		title string
+		want  []string
+	}{
+		{"英語 レポート #宿題 #英語", []string{"宿題", "英語"}},
+		// 全角スペースの後のタグも読み、全角スペースはタグに含めない
+		{"英語　レポート　#宿題　#英語", []string{"宿題", "英語"}},
+		{"＃ＲＥＰＯＲＴ #report", []string{"report"}},
+		// 単語の途中の # はタグにしない
+		{"C#の勉強", nil},
+		{"#", nil},
+	}
+	for _, tt := range tests {
+		if got := Tags(tt.title); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tags(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package todo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+)
+
+// DefaultReminders はリマインダーを送るタイミングの初期値 (期限の1日前と1時間前)
+var DefaultReminders = []time.Duration{24 * time.Hour, time.Hour}
+
+// リマインダーを保存するテーブル
+// sent_at は送った日時。まだ送っていないときは NULL
+const createRemindersTable = `CREATE TABLE IF NOT EXISTS todo_reminders (
+	id INT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	task_id INT UNSIGNED NOT NULL,
+	remind_at DATETIME NOT NULL,
+	sent_at DATETIME NULL,
+	INDEX (task_id),
+	INDEX (remind_at)
+)`
+
+// WithReminders はリマインダーを期限のどれだけ前に送るかを設定する (初期値は DefaultReminders)
+// 何も渡さないときはリマインダーを送らない
+func WithReminders(offsets ...time.Duration) Option {
+	return func(s *Service) {
+		s.reminders = offsets
+	}
+}
+
+// sentRetention は送ったリマインダーを残しておく期間
+const sentRetention = 7 * 24 * time.Hour
+
+// Scheduler はリマインダーの時刻になったらTodoListの持ち主にプッシュメッセージを送る
+// リマインダーはデータベースに保存するので、サーバを再起動しても消えない
+type Scheduler struct {
+	service *Service
+	pusher  bot.Pusher
+}
+
+// NewScheduler は service のリマインダーを pusher で送る Scheduler を作る
+func NewScheduler(service *Service, pusher bot.Pusher) *Scheduler {
+	return &Scheduler{service: service, pusher: pusher}
+}
+
+// Job はリマインダーを1分ごとに確かめて送る bot.Job を返す
+func (s *Scheduler) Job() bot.Job {
+	return bot.Every(time.Minute, s.Tick)
+}
+
+// reminder は送る時刻になったリマインダーと、そのTodo
+type reminder struct {
+	ReminderID uint      `db:"reminder_id"`
+	RemindAt   time.Time `db:"remind_at"`
+	Task
+}
+
+// Tick は now に送る時刻になったリマインダーを送る
+// 同じTodoのリマインダーがいくつも溜まっているときは、いちばん新しいものだけを送る
+func (s *Scheduler) Tick(ctx context.Context, now time.Time) {
+	db := s.service.db
+	if _, err := db.ExecContext(ctx, "DELETE FROM todo_reminders WHERE sent_at < ?", now.Add(-sentRetention)); err != nil {
+		log.Printf("db error: %v", err)
+	}
+	var reminders []reminder
+	err := db.SelectContext(ctx, &reminders,
+		`SELECT r.id AS reminder_id, r.remind_at, t.id, t.todo, t.due_date, t.due_at, t.due_has_time, t.owner_id, t.creator_id
+		FROM todo_reminders r JOIN tasks t ON t.id = r.task_id
+		WHERE r.sent_at IS NULL AND r.remind_at <= ? AND t.status = ?
+		ORDER BY r.task_id, r.remind_at DESC`, now, StatusOpen)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return
+	}
+	for i, r := range reminders {
+		claimed, err := s.claim(ctx, r.ReminderID, now)
+		if err != nil {
+			log.Printf("db error: %v", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		// 同じTodoのもっと新しいリマインダーがあるとき (1日前と1時間前の両方を過ぎたときなど) は送らない
+		if i > 0 && reminders[i-1].ID == r.ID {
+			continue
+		}
+		// 期限を過ぎてから長いあいだ止まっていたときは、もう遅いので送らない
+		// 期限の前なら、リマインダーの時刻から bot.LateWindow より遅れても送る
+		if r.DueAt.Valid && r.DueAt.Time.Before(now) && now.Sub(r.RemindAt) > bot.LateWindow {
+			continue
+		}
+		if err := s.push(ctx, r, now); err != nil {
+			log.Printf("failed to push todo reminder %d: %v", r.ReminderID, err)
+			if _, err := db.ExecContext(ctx, "UPDATE todo_reminders SET sent_at = NULL WHERE id = ?", r.ReminderID); err != nil {
+				log.Printf("db error: %v", err)
+			}
+		}
+	}
+}
+
+// claim はリマインダーを送ったことにする
+// 他の呼び出しが先に送っていたときは false を返す
+func (s *Scheduler) claim(ctx context.Context, id uint, now time.Time) (bool, error) {
+	result, err := s.service.db.ExecContext(ctx, "UPDATE todo_reminders SET sent_at = ? WHERE id = ? AND sent_at IS NULL", now, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// push はリマインダーを完了・スヌーズのボタンと一緒に送る
+func (s *Scheduler) push(ctx context.Context, r reminder, now time.Time) error {
+	due, _ := r.Due(s.service.Location(ctx, r.OwnerID))
+	text := fmt.Sprintf("⏰ 「%s」の%s\n期限: %s", truncate(r.Todo, 60), remaining(due.Time.Sub(now)), due)
+	template := linebot.NewButtonsTemplate("", "", text,
+		linebot.NewPostbackAction("完了にする", reminderPostbackData("done", r.ID, 0), "", "完了にする", "", ""),
+		linebot.NewPostbackAction("1時間後にもう一度", reminderPostbackData("snooze", r.ID, time.Hour), "", "1時間後にもう一度", "", ""),
+		linebot.NewPostbackAction("明日もう一度", reminderPostbackData("snooze", r.ID, 24*time.Hour), "", "明日もう一度", "", ""),
+	)
+	message := linebot.NewTemplateMessage("リマインダー: "+r.Todo, template)
+	_, err := s.pusher.PushMessage(r.OwnerID, message).WithContext(ctx).Do()
+	return err
+}
+
+// remaining は期限までの時間を「期限まであと1時間だよ」の形にする
+func remaining(d time.Duration) string {
+	if d <= 0 {
+		return "期限を過ぎているよ！"
+	}
+	return "期限まであと" + formatDuration(d) + "だよ"
+}
+
+// formatDuration は時間を「1日」「3時間」「30分」のように一番大きな単位で、端数を丸めて表す
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%d日", int((d+12*time.Hour)/(24*time.Hour)))
+	case d >= time.Hour:
+		return fmt.Sprintf("%d時間", int(d.Round(time.Hour)/time.Hour))
+	default:
+		return fmt.Sprintf("%d分", int((d+time.Minute-1)/time.Minute))
+	}
+}
+
+// truncate はLINEのテンプレートに収まるように s を n 文字までにする
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// scheduleReminders は期限が due のTodoのリマインダーを登録し、登録したものを「1日前・1時間前」の形で返す
+// もう過ぎている時刻のリマインダーは登録しない
+func (s *Service) scheduleReminders(ctx context.Context, taskID int64, due, now time.Time) (string, error) {
+	var scheduled []string
+	for _, offset := range s.reminders {
+		at := due.Add(-offset)
+		if !at.After(now) {
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, "INSERT INTO todo_reminders (task_id, remind_at) VALUES (?, ?)", taskID, at); err != nil {
+			return strings.Join(scheduled, "・"), err
+		}
+		scheduled = append(scheduled, formatDuration(offset)+"前")
+	}
+	return strings.Join(scheduled, "・"), nil
+}
+
+// rescheduleReminders は task のまだ送っていないリマインダーを削除し、今の期限で登録し直す
+func (s *Service) rescheduleReminders(ctx context.Context, task Task, now time.Time) (string, error) {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM todo_reminders WHERE task_id = ? AND sent_at IS NULL", task.ID); err != nil {
+		return "", err
+	}
+	if !task.DueAt.Valid {
+		return "", nil
+	}
+	return s.scheduleReminders(ctx, int64(task.ID), task.DueAt.Time, now)
+}
+
+// PostbackAction はリマインダーのボタンのポストバックの action
+// bot.PostbackRouter に Service.PostbackHandler と一緒に登録する
+const PostbackAction = "todo"
+
+// reminderPostbackData はリマインダーのボタンのポストバックのデータをつくる
+// op は done (完了) か snooze (after 後にもう一度送る)
+func reminderPostbackData(op string, taskID uint, after time.Duration) string {
+	values := url.Values{}
+	values.Set("action", PostbackAction)
+	values.Set("op", op)
+	values.Set("id", strconv.FormatUint(uint64(taskID), 10))
+	if after > 0 {
+		values.Set("after", after.String())
+	}
+	return values.Encode()
+}
+
+// PostbackHandler はリマインダーのボタンが押されたときに、Todoを完了にするかリマインダーを後で送り直す
+// bot.PostbackHandler として PostbackAction に登録する
+func (s *Service) PostbackHandler(ctx context.Context, event *linebot.Event, postback *linebot.Postback) linebot.SendingMessage {
+	values := bot.PostbackData(postback)
+	id := values.Get("id")
+	switch values.Get("op") {
+	case "done":
+		// 「todo done」と同じように、追加した人と管理者だけが完了にできる
+		return linebot.NewTextMessage(s.completeTodo(ctx, event.Source, []string{id}))
+	case "snooze":
+		after, err := time.ParseDuration(values.Get("after"))
+		if err != nil || after <= 0 {
+			return nil
+		}
+		return linebot.NewTextMessage(s.snooze(ctx, event.Source, id, after))
+	}
+	return nil
+}
+
+// snooze は送信元のTodoListのTodo id のリマインダーを after 後にもう一度送るように登録する
+// 「todo done」と同じように、追加した人と管理者だけがスヌーズできる
+func (s *Service) snooze(ctx context.Context, source *linebot.EventSource, id string, after time.Duration) string {
+	task, message, ok := s.findTask(ctx, source, id)
+	if !ok {
+		return message
+	}
+	if task.Status != StatusOpen {
+		return fmt.Sprintf("ID:%dのTodoはもう%sだよ", task.ID, task.Status.label())
+	}
+	if _, err := s.db.ExecContext(ctx, "INSERT INTO todo_reminders (task_id, remind_at) VALUES (?, ?)", task.ID, time.Now().Add(after)); err != nil {
+		log.Printf("db error: %v", err)
+		return "Botサーバーでエラーが発生しました"
+	}
+	return fmt.Sprintf("「%s」を%s後にもう一度お知らせするよ", task.Todo, formatDuration(after))
+}
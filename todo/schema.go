@@ -0,0 +1,92 @@
+package todo
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Todoを保存するテーブル
+// ハンズオンで作った tasks テーブルがすでにあるときはそのまま使い、足りない列だけを追加する
+const createTasksTable = `CREATE TABLE IF NOT EXISTS tasks (
+	id INT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	todo VARCHAR(255) NOT NULL,
+	due_date VARCHAR(255) NOT NULL
+)`
+
+// column はテーブルに後から追加した列
+type column struct {
+	table      string
+	name       string
+	definition string
+}
+
+// テーブルに後から追加した列
+// ハンズオンで作ったテーブルや以前に作ったテーブルにはないので、なければ ALTER TABLE で追加する
+var addedColumns = []column{
+	// owner_id はTodoListの持ち主 (ユーザー・グループ・トークルームのID)
+	// 持ち主のいない以前のTodoは誰のTodoListにも表示されない
+	{"tasks", "owner_id", "VARCHAR(64) NOT NULL DEFAULT '', ADD INDEX (owner_id)"},
+	// creator_id はTodoを追加したユーザーのID
+	{"tasks", "creator_id", "VARCHAR(64) NOT NULL DEFAULT ''"},
+	// due_at は due_date を読み取った期限の日時。読み取れなかった以前のTodoは NULL
+	// due_date には送られてきた期限の文字列をそのまま残す
+	{"tasks", "due_at", "DATETIME NULL, ADD INDEX (due_at)"},
+	// due_has_time は期限に時刻まで指定したかどうか
+	{"tasks", "due_has_time", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	// status はTodoの状態 (open, done, cancelled)。以前のTodoはまだ終わっていないものとする
+	{"tasks", "status", "VARCHAR(16) NOT NULL DEFAULT 'open', ADD INDEX (owner_id, status)"},
+	// completed_at は完了・取り消しにした日時
+	{"tasks", "completed_at", "DATETIME NULL"},
+	// priority はTodoの優先度 (1: 低, 2: 中, 3: 高)
+	{"tasks", "priority", "TINYINT NOT NULL DEFAULT 2"},
+	// todo_history の priority は変更する前の優先度
+	{"todo_history", "priority", "TINYINT NOT NULL DEFAULT 2"},
+}
+
+// TodoListごとの設定を保存するテーブル
+// timezone は期限を数えるタイムゾーンの名前 (Asia/Tokyo など)
+const createTodoSettingsTable = `CREATE TABLE IF NOT EXISTS todo_settings (
+	owner_id VARCHAR(64) NOT NULL PRIMARY KEY,
+	timezone VARCHAR(64) NOT NULL
+)`
+
+// migrate はTodoListで使うテーブルを作成し、足りない列を追加する
+func migrate(ctx context.Context, db *sqlx.DB) error {
+	for _, table := range []string{createTasksTable, createTodoSettingsTable, createRemindersTable, createHistoryTable, createTagsTable} {
+		if _, err := db.ExecContext(ctx, table); err != nil {
+			return err
+		}
+	}
+	for _, c := range addedColumns {
+		var exists int
+		err := db.GetContext(ctx, &exists,
+			"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?", c.table, c.name)
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, "ALTER TABLE "+c.table+" ADD COLUMN "+c.name+" "+c.definition); err != nil {
+			return err
+		}
+	}
+	return backfillTags(ctx, db)
+}
+
+// backfillTags はタグを保存していなかったころに追加したTodoのタグを保存する
+func backfillTags(ctx context.Context, db *sqlx.DB) error {
+	var tasks []Task
+	err := db.SelectContext(ctx, &tasks,
+		"SELECT id, todo FROM tasks WHERE (todo LIKE '%#%' OR todo LIKE '%＃%') AND NOT EXISTS (SELECT 1 FROM todo_tags WHERE todo_tags.task_id = tasks.id)")
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if err := syncTags(ctx, db, task.ID, task.Todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,549 @@
+// Package todo はMySQLデータベースを使ったTodoList機能
+package todo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	// データベースやOSにタイムゾーンの情報がなくても Asia/Tokyo などを読み込めるようにする
+	_ "time/tzdata"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+)
+
+// HelpMessage はTodoListの使い方
+const HelpMessage = `TodoList:
+	"todo"に続けて実行したい操作を入力してね！
+		list [today|overdue|#タグ|priority:high]
+		add "タスク名" "期限" [!高|!中|!低]
+		done "タスクID"
+		cancel "タスクID"
+		edit "タスクID" 名前|期限 "新しい値"
+		undo
+		archive
+		timezone "タイムゾーン"
+	期限は「明日 18:00」「3日後」「来週金曜」「2/24」「tomorrow 6pm」のようにも書けるよ
+	空白を含むタスク名は "英語 レポート" のように引用符で囲んでね
+	タスク名に #レポート のように書くとタグになり、「todo list #レポート」で絞り込めるよ
+	期限が近づいたらリマインダーを送るよ (1日前と1時間前など)
+	例:
+		todo list
+		todo add レポート 2/24
+		todo add 買い物 明日 18:00
+		todo add "#英語 レポート" 金曜 !高
+		todo list today
+		todo done 12
+		todo edit 12 期限 来週金曜
+		todo undo
+		todo timezone America/New_York
+	グループではメンバー全員でTodoListを共有するよ！(変更できるのは追加した人だけ)`
+
+// データベースでTodoを扱う形式 (構造体)
+type Task struct {
+	ID   uint   `db:"id"`
+	Todo string `db:"todo"`
+	// DueDate は送られてきた期限の文字列
+	DueDate string `db:"due_date"`
+	// DueAt は DueDate を読み取った期限の日時。以前のTodoで読み取れなかったときは無効
+	DueAt sql.NullTime `db:"due_at"`
+	// DueHasTime は期限に時刻まで指定したかどうか
+	DueHasTime bool `db:"due_has_time"`
+	// OwnerID はTodoListの持ち主 (ユーザー・グループ・トークルームのID)
+	OwnerID string `db:"owner_id"`
+	// CreatorID はTodoを追加したユーザーのID
+	CreatorID string `db:"creator_id"`
+	// Status はTodoの状態
+	Status Status `db:"status"`
+	// CompletedAt は完了・取り消しにした日時。未完了のときは無効
+	CompletedAt sql.NullTime `db:"completed_at"`
+	// Priority は優先度
+	Priority Priority `db:"priority"`
+}
+
+// taskColumns は Task に読み込む tasks テーブルの列
+const taskColumns = "id, todo, due_date, due_at, due_has_time, owner_id, creator_id, status, completed_at, priority"
+
+// Status はTodoの状態
+type Status string
+
+const (
+	// StatusOpen はまだ終わっていないTodo
+	StatusOpen Status = "open"
+	// StatusDone は完了したTodo
+	StatusDone Status = "done"
+	// StatusCancelled は取り消したTodo
+	StatusCancelled Status = "cancelled"
+)
+
+// label は返信で使う状態の名前
+func (s Status) label() string {
+	switch s {
+	case StatusDone:
+		return "完了"
+	case StatusCancelled:
+		return "取り消し"
+	}
+	return "未完了"
+}
+
+// 「todo archive」で表示する数の上限
+const archiveLimit = 20
+
+// Due は期限を loc のタイムゾーンで返す。期限の日時がないときは false
+func (t Task) Due(loc *time.Location) (Due, bool) {
+	if !t.DueAt.Valid {
+		return Due{}, false
+	}
+	return Due{Time: t.DueAt.Time.In(loc), HasTime: t.DueHasTime}, true
+}
+
+// sameDue は t と other の読み取った期限が同じかを返す
+// 送られてきた文字列が同じでも、「明日」のような言葉は送った日によって違う日時になる
+func (t Task) sameDue(other Task) bool {
+	if t.DueAt.Valid != other.DueAt.Valid || t.DueHasTime != other.DueHasTime {
+		return false
+	}
+	return !t.DueAt.Valid || t.DueAt.Time.Equal(other.DueAt.Time)
+}
+
+// dueText は一覧に表示する期限
+// 期限の日時がない以前のTodoは送られてきた文字列のまま表示する
+func (t Task) dueText(loc *time.Location) string {
+	if due, ok := t.Due(loc); ok {
+		return due.String()
+	}
+	return t.DueDate
+}
+
+// Service はTodoListの操作をまとめたもの
+//
+// TodoListはメッセージの送信元ごとに分かれている。1対1のトークではそのユーザーだけの、
+// グループ・トークルームではメンバー全員で共有するTodoListになる。
+// 共有するTodoListは誰でも見られるが、削除できるのはTodoを追加した人と管理者だけ
+type Service struct {
+	db       *sqlx.DB
+	admins   map[string]bool
+	location *time.Location
+	// reminders はリマインダーを期限のどれだけ前に送るか
+	reminders []time.Duration
+}
+
+// Option は Service の設定を変える
+type Option func(*Service)
+
+// WithAdmins は誰のTodoでも削除できる管理者のユーザーIDを設定する
+func WithAdmins(userIDs ...string) Option {
+	return func(s *Service) {
+		for _, id := range userIDs {
+			s.admins[id] = true
+		}
+	}
+}
+
+// WithLocation は期限を数えるタイムゾーンの初期値を設定する (初期値は Asia/Tokyo)
+// TodoListごとのタイムゾーンは「todo timezone」で変えられる
+func WithLocation(loc *time.Location) Option {
+	return func(s *Service) {
+		s.location = loc
+	}
+}
+
+// New はデータベース db を使う Service を作る
+// Todoを保存するテーブルがなければ作成し、足りない列があれば追加する
+func New(ctx context.Context, db *sqlx.DB, opts ...Option) (*Service, error) {
+	if err := migrate(ctx, db); err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		return nil, err
+	}
+	s := &Service{db: db, admins: map[string]bool{}, location: loc, reminders: DefaultReminders}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// Handler は「todo」で始まるメッセージに返信する
+func (s *Service) Handler(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	text, ok := bot.Text(event)
+	if !ok {
+		return nil
+	}
+	return linebot.NewTextMessage(s.Deal(ctx, event.Source, text))
+}
+
+// Forget は source のTodoListを削除する
+// ブロックされたときやグループから退出させられたときに呼び出す
+func (s *Service) Forget(ctx context.Context, source *linebot.EventSource) {
+	ownerID := bot.SourceID(source)
+	if ownerID == "" {
+		return
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE todo_reminders FROM todo_reminders JOIN tasks ON tasks.id = todo_reminders.task_id WHERE tasks.owner_id = ?", ownerID); err != nil {
+		log.Printf("db error: %v", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE todo_tags FROM todo_tags JOIN tasks ON tasks.id = todo_tags.task_id WHERE tasks.owner_id = ?", ownerID); err != nil {
+		log.Printf("db error: %v", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM tasks WHERE owner_id = ?", ownerID); err != nil {
+		log.Printf("db error: %v", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM todo_history WHERE owner_id = ?", ownerID); err != nil {
+		log.Printf("db error: %v", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM todo_settings WHERE owner_id = ?", ownerID); err != nil {
+		log.Printf("db error: %v", err)
+	}
+}
+
+// Location は ownerID のTodoListで期限を数えるタイムゾーンを返す
+// 設定していないときは WithLocation で設定したタイムゾーンにする
+func (s *Service) Location(ctx context.Context, ownerID string) *time.Location {
+	var name string
+	err := s.db.GetContext(ctx, &name, "SELECT timezone FROM todo_settings WHERE owner_id = ?", ownerID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("db error: %v", err)
+		}
+		return s.location
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("todo: unknown timezone %q: %v", name, err)
+		return s.location
+	}
+	return loc
+}
+
+// todo add の使い方
+const addUsage = `todo add "タスク名" "期限"`
+
+// subcommands は「todo」に続けて入力できる操作
+var subcommands = map[string]subcommand{
+	// Todoリスト表示
+	"list": {usage: listUsage, minArgs: 0, maxArgs: -1, run: (*Service).getTodoList},
+	// TodoリストにTodoを追加
+	"add": {usage: addUsage, minArgs: 2, maxArgs: -1, run: (*Service).addTodo},
+	// 指定したIDのTodoを完了にする
+	"done": {usage: `todo done "タスクID"`, minArgs: 1, maxArgs: 1, run: (*Service).completeTodo},
+	// 指定したIDのTodoを取り消す
+	"cancel": {usage: `todo cancel "タスクID"`, minArgs: 1, maxArgs: 1, run: (*Service).cancelTodo},
+	// 指定したIDのTodoのタスク名か期限を変える
+	"edit": {usage: editUsage, minArgs: 3, maxArgs: -1, run: (*Service).editTodo},
+	// 最後にした変更を元に戻す
+	"undo": {usage: "todo undo", minArgs: 0, maxArgs: 0, run: (*Service).undo},
+	// 完了・取り消ししたTodoの一覧
+	"archive": {usage: "todo archive", minArgs: 0, maxArgs: 0, run: (*Service).getArchive},
+	// 期限を数えるタイムゾーンの設定
+	"timezone": {usage: `todo timezone "タイムゾーン"`, minArgs: 0, maxArgs: 1, run: (*Service).setTimezone},
+}
+
+// Deal はTodo用のメッセージを生成する
+// source はメッセージの送信元で、誰のTodoListを操作するかを決める
+func (s *Service) Deal(ctx context.Context, source *linebot.EventSource, text string) string {
+	// 受け取ったメッセージを引数に区切る
+	args, err := splitArgs(text)
+	if err != nil {
+		return err.Error()
+	}
+
+	// 操作が指定されていないときや、知らない操作のときはヘルプを返す
+	if len(args) <= 1 {
+		return HelpMessage
+	}
+	command, ok := subcommands[strings.ToLower(args[1])]
+	if !ok {
+		return HelpMessage
+	}
+	if usage, ok := command.validate(args[2:]); !ok {
+		return usage
+	}
+	return command.run(s, ctx, source, args[2:])
+}
+
+// TodoリストへのTodoの追加
+// タスク名も期限も空白を含めて書けるので、引用符で囲まれていないときは
+// 期限として読み取れるいちばん長い後ろの部分を期限、残りをタスク名にする
+// (例: 「英語 レポート 明日 18:00」はタスク名「英語 レポート」、期限「明日 18:00」)
+func (s *Service) addTodo(ctx context.Context, source *linebot.EventSource, args []string) string {
+	ownerID := bot.SourceID(source)
+	loc := s.Location(ctx, ownerID)
+	now := time.Now().In(loc)
+	// 「!高」「priority:high」は優先度として取り出し、残りをタスク名と期限にする
+	priority := PriorityMedium
+	rest := make([]string, 0, len(args))
+	for _, arg := range args {
+		if p, ok := parsePriorityArg(arg); ok {
+			priority = p
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	if len(rest) < 2 {
+		return "使い方: " + addUsage
+	}
+	title, dueText, due, err := splitTitleAndDue(rest, now)
+	if err != nil {
+		return err.Error()
+	}
+	if strings.TrimSpace(title) == "" {
+		return "タスク名が空だよ\n使い方: " + addUsage
+	}
+
+	// MySQLデータベースへのクエリを発行して、送信元のTodoListにTodoを追加する
+	result, err := s.db.ExecContext(ctx, "INSERT INTO tasks (todo, due_date, due_at, due_has_time, owner_id, creator_id, priority) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		title, dueText, due.Time, due.HasTime, ownerID, source.UserID, priority)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return "Botサーバーでエラーが発生しました"
+	}
+
+	// (最後の)追加されたTodoのIDを取得する
+	todoID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return "Botサーバーでエラーが発生しました"
+	}
+
+	// タスク名のタグを保存し、「todo undo」で追加を取り消せるように記録する。どちらもできなくてもTodoは追加できている
+	if err := syncTags(ctx, s.db, uint(todoID), title); err != nil {
+		log.Printf("db error: %v", err)
+	}
+	added := Task{ID: uint(todoID), Todo: title, DueDate: dueText, OwnerID: ownerID, CreatorID: source.UserID, Status: StatusOpen, Priority: priority}
+	if err := record(ctx, s.db, source, opAdd, added); err != nil {
+		log.Printf("db error: %v", err)
+	}
+
+	// 期限の前に送るリマインダーを登録する。登録できなくてもTodoは追加できている
+	reminders, err := s.scheduleReminders(ctx, todoID, due.Time, now)
+	if err != nil {
+		log.Printf("db error: %v", err)
+	}
+
+	// メッセージの生成
+	// 読み取った期限を返して、思った通りに読み取れたかを確かめてもらう
+	replyMessage := fmt.Sprintf("todo added\nID:%d\ntodo:%v\n期限:「%s」を %v と読み取ったよ\n優先度:%v", todoID, title, dueText, due, priority)
+	if tags := Tags(title); len(tags) > 0 {
+		replyMessage += "\nタグ:#" + strings.Join(tags, " #")
+	}
+	if reminders != "" {
+		replyMessage += fmt.Sprintf("\nリマインダー:%s", reminders)
+	}
+	return replyMessage
+}
+
+// findTask は送信元のTodoListから arg をIDとするTodoを探し、source のユーザーが変更できるかを確かめる
+// 共有しているTodoListでは、Todoを追加した人と管理者だけが変更できる
+// 見つからないときや変更できないときは、返信するメッセージを返す
+func (s *Service) findTask(ctx context.Context, source *linebot.EventSource, arg string) (Task, string, bool) {
+	// IDを文字列から数値に変換する
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return Task{}, fmt.Sprintf("「%s」はTodoのIDではないよ\n「todo list」でIDを確かめてね", arg), false
+	}
+
+	// 送信元のTodoListにそのIDのTodoがあるかを確かめる
+	var task Task
+	err = s.db.GetContext(ctx, &task, "SELECT "+taskColumns+" FROM tasks WHERE id = ? AND owner_id = ?", id, bot.SourceID(source))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Task{}, fmt.Sprintf("ID:%dのTodoは見つからなかったよ\n「todo list」でIDを確かめてね", id), false
+	}
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return Task{}, "Botサーバーでエラーが発生しました", false
+	}
+	// ユーザーIDがわからない送信元からは、管理者かどうかも確かめられないので変更できない
+	if source.UserID == "" || (task.CreatorID != source.UserID && !s.admins[source.UserID]) {
+		return Task{}, fmt.Sprintf("ID:%dのTodoは追加した人か管理者しか変更できないよ", id), false
+	}
+	return task, "", true
+}
+
+// Todoの完了
+func (s *Service) completeTodo(ctx context.Context, source *linebot.EventSource, args []string) string {
+	return s.setStatus(ctx, source, args[0], StatusDone)
+}
+
+// Todoの取り消し
+func (s *Service) cancelTodo(ctx context.Context, source *linebot.EventSource, args []string) string {
+	return s.setStatus(ctx, source, args[0], StatusCancelled)
+}
+
+// setStatus は arg をIDとするTodoの状態を status (完了か取り消し) にする
+// 行は削除せずに残すので、「todo undo」で元に戻したり「todo archive」で見返したりできる
+func (s *Service) setStatus(ctx context.Context, source *linebot.EventSource, arg string, status Status) string {
+	task, message, ok := s.findTask(ctx, source, arg)
+	if !ok {
+		return message
+	}
+	if task.Status == status {
+		return fmt.Sprintf("ID:%dのTodoはもう%sだよ", task.ID, status.label())
+	}
+
+	// 完了・取り消しにした日時を completed_at に記録する
+	completedAt := sql.NullTime{Time: time.Now(), Valid: true}
+	err := s.change(ctx, source, operation(status), task, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE tasks SET status = ?, completed_at = ? WHERE id = ? AND owner_id = ?", status, completedAt, task.ID, task.OwnerID)
+		return err
+	})
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return "Botサーバーでエラーが発生しました"
+	}
+
+	// メッセージの生成
+	replyMessage := fmt.Sprintf("todo %s\nID:%d\ntodo:%v", status, task.ID, task.Todo)
+	if status == StatusDone {
+		replyMessage += "\nおつかれさま！"
+	}
+	return replyMessage + "\n間違えたときは「todo undo」で元に戻せるよ"
+}
+
+// todo edit の使い方
+const editUsage = `todo edit "タスクID" 名前 "新しいタスク名"
+todo edit "タスクID" 期限 "新しい期限"
+todo edit "タスクID" 優先度 高|中|低`
+
+// Todoの変更
+// 「todo edit 12 名前 英語レポート」でタスク名を、「todo edit 12 期限 明日 18:00」で期限を、
+// 「todo edit 12 優先度 高」で優先度を変える
+func (s *Service) editTodo(ctx context.Context, source *linebot.EventSource, args []string) string {
+	task, message, ok := s.findTask(ctx, source, args[0])
+	if !ok {
+		return message
+	}
+	value := strings.Join(args[2:], " ")
+	if strings.TrimSpace(value) == "" {
+		return "使い方: " + editUsage
+	}
+
+	loc := s.Location(ctx, task.OwnerID)
+	now := time.Now().In(loc)
+	edited := task
+	switch strings.ToLower(args[1]) {
+	case "名前", "タスク名", "title", "name":
+		edited.Todo = value
+	case "期限", "due":
+		due, err := ParseDue(value, now)
+		if err != nil {
+			return err.Error()
+		}
+		edited.DueDate = value
+		edited.DueAt = sql.NullTime{Time: due.Time, Valid: true}
+		edited.DueHasTime = due.HasTime
+	case "優先度", "priority":
+		priority, ok := ParsePriority(value)
+		if !ok {
+			return "優先度は 高・中・低 (high・medium・low) で指定してね"
+		}
+		edited.Priority = priority
+	default:
+		return "使い方: " + editUsage
+	}
+
+	err := s.change(ctx, source, opEdit, task, func(tx *sqlx.Tx) error {
+		if err := updateTask(ctx, tx, edited); err != nil {
+			return err
+		}
+		return syncTags(ctx, tx, edited.ID, edited.Todo)
+	})
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return "Botサーバーでエラーが発生しました"
+	}
+	// 期限が変わったときは、まだ送っていないリマインダーを新しい期限で登録し直す
+	replyMessage := fmt.Sprintf("todo edited\nID:%d\ntodo:%v\n期限:%v\n優先度:%v", edited.ID, edited.Todo, edited.dueText(loc), edited.Priority)
+	if !edited.sameDue(task) {
+		reminders, err := s.rescheduleReminders(ctx, edited, now)
+		if err != nil {
+			log.Printf("db error: %v", err)
+		}
+		if reminders != "" {
+			replyMessage += fmt.Sprintf("\nリマインダー:%s", reminders)
+		}
+	}
+	return replyMessage
+}
+
+// 完了・取り消ししたTodoの一覧
+// 新しく完了したものから順に表示し、今週 (月曜から) 完了した数も答える
+func (s *Service) getArchive(ctx context.Context, source *linebot.EventSource, _ []string) string {
+	ownerID := bot.SourceID(source)
+	loc := s.Location(ctx, ownerID)
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	weekStart := weekday(today, time.Monday, true, 0)
+
+	var tasks []Task
+	err := s.db.SelectContext(ctx, &tasks, "SELECT "+taskColumns+" FROM tasks WHERE owner_id = ? AND status <> ? ORDER BY completed_at DESC, id DESC LIMIT ?",
+		ownerID, StatusOpen, archiveLimit)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return "Botサーバーでエラーが発生しました"
+	}
+	var finished int
+	err = s.db.GetContext(ctx, &finished, "SELECT COUNT(*) FROM tasks WHERE owner_id = ? AND status = ? AND completed_at >= ?", ownerID, StatusDone, weekStart)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return "Botサーバーでエラーが発生しました"
+	}
+
+	// メッセージの生成
+	replyMessage := fmt.Sprintf("今週完了したTodo: %d件\nID/ToDo/完了日", finished)
+	for _, task := range tasks {
+		completed := ""
+		if task.CompletedAt.Valid {
+			completed = Due{Time: task.CompletedAt.Time.In(loc), HasTime: true}.String()
+		}
+		replyMessage += fmt.Sprintf("\n%d/%v/%v", task.ID, task.Todo, completed)
+		if task.Status == StatusCancelled {
+			replyMessage += " (取り消し)"
+		}
+	}
+	return replyMessage
+}
+
+// 期限を数えるタイムゾーンの設定
+// 「todo timezone」だけのときは今のタイムゾーンを返す
+func (s *Service) setTimezone(ctx context.Context, source *linebot.EventSource, args []string) string {
+	ownerID := bot.SourceID(source)
+	if len(args) == 0 {
+		return fmt.Sprintf("今のタイムゾーンは%sだよ\n「todo timezone Asia/Tokyo」のように変えられるよ", s.Location(ctx, ownerID))
+	}
+	loc, err := time.LoadLocation(args[0])
+	// 空文字列や "Local" はサーバーの設定によって変わってしまうので受け付けない
+	if err != nil || args[0] == "" || args[0] == "Local" {
+		return fmt.Sprintf("「%s」というタイムゾーンは見つからなかったよ\n「Asia/Tokyo」「America/New_York」のように書いてね", args[0])
+	}
+
+	_, err = s.db.ExecContext(ctx, "INSERT INTO todo_settings (owner_id, timezone) VALUES (?, ?) ON DUPLICATE KEY UPDATE timezone = VALUES(timezone)",
+		ownerID, loc.String())
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return "Botサーバーでエラーが発生しました"
+	}
+	return fmt.Sprintf("タイムゾーンを%sにしたよ", loc)
+}
+
+// splitTitleAndDue は todo add の引数をタスク名と期限に分ける
+// 後ろの引数ほど期限とみなし、期限として読み取れるいちばん長い部分を期限にする
+func splitTitleAndDue(args []string, now time.Time) (title, dueText string, due Due, err error) {
+	for i := 1; i < len(args); i++ {
+		dueText = strings.Join(args[i:], " ")
+		if due, err = ParseDue(dueText, now); err == nil {
+			return strings.Join(args[:i], " "), dueText, due, nil
+		}
+	}
+	// どこで分けても読み取れないときは、最後の引数を期限として読み取ったときのエラーを返す
+	return "", "", Due{}, err
+}
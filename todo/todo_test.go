@@ -0,0 +1,30 @@
+package todo
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestSameDueComparesParsedTime(t *testing.T) {
+	// どちらも「明日」と送ったが、送った日が違う
+	yesterday := Task{DueDate: "明日", DueAt: sql.NullTime{Time: time.Date(2023, 2, 24, 23, 59, 59, 0, jst), Valid: true}}
+	today := Task{DueDate: "明日", DueAt: sql.NullTime{Time: time.Date(2023, 2, 25, 23, 59, 59, 0, jst), Valid: true}}
+	if yesterday.sameDue(today) {
+		t.Error("got the same due, want the due to have moved")
+	}
+
+	// 書き方が違っても同じ日時なら変わっていない
+	sameTime := Task{DueDate: "2/24", DueAt: yesterday.DueAt}
+	if !yesterday.sameDue(sameTime) {
+		t.Error("got a different due, want the same due")
+	}
+
+	withTime := Task{DueDate: "2/24 23:59", DueAt: yesterday.DueAt, DueHasTime: true}
+	if yesterday.sameDue(withTime) {
+		t.Error("got the same due, want a due with a time to differ")
+	}
+	if !(Task{DueDate: "いつか"}).sameDue(Task{DueDate: "そのうち"}) {
+		t.Error("got a different due, want tasks without a due to be the same")
+	}
+}
@@ -0,0 +1,366 @@
+package weather
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 警報を出すかを確かめる範囲。これから3時間の予報を見る
+const alertWindow = 3 * time.Hour
+
+// 同じ種類の警報を続けて送らない時間
+// 雨が何時間も続くときに、3時間ごとに同じ警報を送らないようにする
+const alertCooldown = 6 * time.Hour
+
+// 値を指定せずに警報を設定したときの初期値
+const (
+	defaultRainProbability Percent         = 50
+	defaultMinTemperature  Celsius         = 0
+	defaultMaxWindSpeed    MetersPerSecond = 10
+)
+
+// AlertKind は警報の種類
+type AlertKind string
+
+const (
+	// AlertRain は降水確率が高いときの警報
+	AlertRain AlertKind = "rain"
+	// AlertCold は気温が低いときの警報
+	AlertCold AlertKind = "cold"
+	// AlertWind は風が強いときの警報
+	AlertWind AlertKind = "wind"
+)
+
+// Alert は登録した場所の天気が悪くなりそうなときに送る警報の設定
+// しきい値が nil の種類の警報は送らない
+type Alert struct {
+	Subscription
+	// RainProbability 以上の降水確率になりそうなら送る
+	RainProbability *Percent `db:"rain_probability"`
+	// MinTemperature を下回る気温になりそうなら送る
+	MinTemperature *Celsius `db:"min_temperature"`
+	// MaxWindSpeed 以上の風速になりそうなら送る
+	MaxWindSpeed *MetersPerSecond `db:"max_wind_speed"`
+	// QuietStart から QuietEnd まで (0時からの分) は警報を送らない
+	// 22:00-07:00 のように日付をまたいでもよい
+	QuietStart *int `db:"quiet_start"`
+	QuietEnd   *int `db:"quiet_end"`
+}
+
+// Enabled は警報を1つでも設定しているかを返す
+func (a Alert) Enabled() bool {
+	return a.RainProbability != nil || a.MinTemperature != nil || a.MaxWindSpeed != nil
+}
+
+// quiet は now が警報を送らない時間に入っているかを返す
+func (a Alert) quiet(now time.Time) bool {
+	if a.QuietStart == nil || a.QuietEnd == nil {
+		return false
+	}
+	local := now.In(a.Location())
+	minute := local.Hour()*60 + local.Minute()
+	start, end := *a.QuietStart, *a.QuietEnd
+	if start <= end {
+		return start <= minute && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// 警報の設定を保存するテーブル
+const createWeatherAlertsTable = `CREATE TABLE IF NOT EXISTS weather_alerts (
+	subscription_id BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+	rain_probability DOUBLE NULL,
+	min_temperature DOUBLE NULL,
+	max_wind_speed DOUBLE NULL,
+	quiet_start SMALLINT NULL,
+	quiet_end SMALLINT NULL
+)`
+
+// 送った警報を記録するテーブル
+// forecast_time は警報のもとになった予報の時刻で、同じ予報で何度も送らないために使う
+const createWeatherAlertEventsTable = `CREATE TABLE IF NOT EXISTS weather_alert_events (
+	subscription_id BIGINT UNSIGNED NOT NULL,
+	kind VARCHAR(16) NOT NULL,
+	forecast_time DATETIME NOT NULL,
+	sent_at DATETIME NOT NULL,
+	PRIMARY KEY (subscription_id, kind, forecast_time),
+	INDEX (sent_at)
+)`
+
+const alertColumns = "s.id, s.source_id, s.place, s.latitude, s.longitude, s.notify_minute, s.utc_offset, " +
+	"a.rain_probability, a.min_temperature, a.max_wind_speed, a.quiet_start, a.quiet_end"
+
+// Alert は sourceID の登録番号 id の警報の設定を返す
+// 警報を設定していないときは、しきい値がすべて nil の Alert を返す
+// 登録が見つからなかったときは nil を返す
+func (s *SubscriptionStore) Alert(ctx context.Context, sourceID string, id uint64) (*Alert, error) {
+	var alert Alert
+	err := s.db.GetContext(ctx, &alert, "SELECT "+alertColumns+" FROM weather_subscriptions s LEFT JOIN weather_alerts a ON a.subscription_id = s.id WHERE s.id = ? AND s.source_id = ?", id, sourceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// SaveAlert は警報の設定を保存する
+func (s *SubscriptionStore) SaveAlert(ctx context.Context, alert *Alert) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO weather_alerts (subscription_id, rain_probability, min_temperature, max_wind_speed, quiet_start, quiet_end) VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE rain_probability = VALUES(rain_probability), min_temperature = VALUES(min_temperature), max_wind_speed = VALUES(max_wind_speed), quiet_start = VALUES(quiet_start), quiet_end = VALUES(quiet_end)`,
+		alert.ID, alert.RainProbability, alert.MinTemperature, alert.MaxWindSpeed, alert.QuietStart, alert.QuietEnd)
+	return err
+}
+
+// Alerts は警報を1つでも設定しているすべての登録を返す
+func (s *SubscriptionStore) Alerts(ctx context.Context) ([]Alert, error) {
+	var alerts []Alert
+	err := s.db.SelectContext(ctx, &alerts, "SELECT "+alertColumns+" FROM weather_alerts a JOIN weather_subscriptions s ON s.id = a.subscription_id "+
+		"WHERE a.rain_probability IS NOT NULL OR a.min_temperature IS NOT NULL OR a.max_wind_speed IS NOT NULL")
+	return alerts, err
+}
+
+// markAlerted は登録 id に forecastTime の予報で kind の警報を送ったことを記録する
+// 同じ予報か、alertCooldown 以内の予報ですでに送っていたときは false を返す
+func (s *SubscriptionStore) markAlerted(ctx context.Context, id uint64, kind AlertKind, forecastTime time.Time) (bool, error) {
+	var sent int
+	err := s.db.GetContext(ctx, &sent, "SELECT COUNT(*) FROM weather_alert_events WHERE subscription_id = ? AND kind = ? AND forecast_time BETWEEN ? AND ?",
+		id, kind, forecastTime.Add(-alertCooldown), forecastTime.Add(alertCooldown))
+	if err != nil {
+		return false, err
+	}
+	if sent > 0 {
+		return false, nil
+	}
+	// 複数台で同時に確かめたときは、記録できた1台だけが送る
+	result, err := s.db.ExecContext(ctx, "INSERT IGNORE INTO weather_alert_events (subscription_id, kind, forecast_time, sent_at) VALUES (?, ?, ?, ?)",
+		id, kind, forecastTime, time.Now())
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// unmarkAlerted は送れなかった警報の記録を削除して、次に確かめたときにもう一度送れるようにする
+func (s *SubscriptionStore) unmarkAlerted(ctx context.Context, id uint64, kind AlertKind, forecastTime time.Time) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM weather_alert_events WHERE subscription_id = ? AND kind = ? AND forecast_time = ?", id, kind, forecastTime)
+	return err
+}
+
+// purgeAlertEvents は before より前に送った警報の記録を削除する
+func (s *SubscriptionStore) purgeAlertEvents(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM weather_alert_events WHERE sent_at < ?", before)
+	return err
+}
+
+// alertEvent はしきい値を超えそうな予報
+type alertEvent struct {
+	kind AlertKind
+	// forecast はしきい値を超えた最初の予報
+	forecast Conditions
+}
+
+// alertEvents は forecast のうち now から alertWindow の間の予報で、alert のしきい値を超えるものを種類ごとに返す
+func alertEvents(alert Alert, forecast *HourlyForecast, now time.Time) []alertEvent {
+	var events []alertEvent
+	found := map[AlertKind]bool{}
+	for _, hour := range forecast.Hours {
+		if !hour.Time.Add(forecast.Interval).After(now) || !hour.Time.Before(now.Add(alertWindow)) {
+			continue
+		}
+		check := func(kind AlertKind, crossed bool) {
+			if crossed && !found[kind] {
+				found[kind] = true
+				events = append(events, alertEvent{kind: kind, forecast: hour})
+			}
+		}
+		check(AlertRain, alert.RainProbability != nil && Known(hour.PrecipitationProbability) && hour.PrecipitationProbability >= *alert.RainProbability)
+		check(AlertCold, alert.MinTemperature != nil && Known(hour.Temperature) && hour.Temperature < *alert.MinTemperature)
+		check(AlertWind, alert.MaxWindSpeed != nil && Known(hour.WindSpeed) && hour.WindSpeed >= *alert.MaxWindSpeed)
+	}
+	return events
+}
+
+// alertLine は警報の1行を "☔ 15時ごろ 降水確率 70%" の形でつくる
+// 気温と風速は units の単位で表す
+func alertLine(event alertEvent, loc *time.Location, units Units) string {
+	at := fmt.Sprintf("%d時ごろ", event.forecast.Time.In(loc).Hour())
+	switch event.kind {
+	case AlertRain:
+		return "☔ " + at + " 降水確率 " + formatPercent(event.forecast.PrecipitationProbability)
+	case AlertCold:
+		return "🥶 " + at + " 気温 " + units.Temperature(event.forecast.Temperature)
+	default:
+		return "💨 " + at + " 風速 " + units.WindSpeed(event.forecast.WindSpeed)
+	}
+}
+
+// describe は警報の設定を文章にする
+// しきい値は摂氏・メートル毎秒で保存しているので、気温と風速は units の単位に直して表す
+func (a Alert) describe(units Units) string {
+	lines := []string{fmt.Sprintf("登録番号%d (%s) の警報", a.ID, a.Place)}
+	if a.RainProbability != nil {
+		lines = append(lines, fmt.Sprintf("・雨: 降水確率 %.0f%% 以上", float64(*a.RainProbability)))
+	}
+	if a.MinTemperature != nil {
+		lines = append(lines, fmt.Sprintf("・気温: %s 未満", units.thresholdTemperature(*a.MinTemperature)))
+	}
+	if a.MaxWindSpeed != nil {
+		lines = append(lines, fmt.Sprintf("・風: 風速 %s 以上", units.thresholdWindSpeed(*a.MaxWindSpeed)))
+	}
+	if !a.Enabled() {
+		lines = append(lines, "・設定していないよ")
+	}
+	if a.QuietStart != nil && a.QuietEnd != nil {
+		lines = append(lines, fmt.Sprintf("・おやすみ: %s-%s は送らない", clock(*a.QuietStart), clock(*a.QuietEnd)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// clock は0時からの分を "07:00" の形にする
+func clock(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
+
+// 警報の設定のコマンドで使う言葉
+var (
+	alertKindWords = map[string]AlertKind{
+		"雨": AlertRain, "rain": AlertRain,
+		"気温": AlertCold, "寒さ": AlertCold, "cold": AlertCold,
+		"風": AlertWind, "wind": AlertWind,
+	}
+	alertQuietWords = []string{"おやすみ", "quiet"}
+	alertOffWords   = []string{"オフ", "off"}
+)
+
+// isWord は word が words のどれかと同じかを返す
+func isWord(word string, words []string) bool {
+	for _, w := range words {
+		if strings.EqualFold(word, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAlertArgs は「雨 60 風 15 おやすみ 22:00-07:00」のような設定を alert に反映する
+// 気温と風速の値は units の単位で読み、摂氏・メートル毎秒に直して保存する
+// 読めない設定があったときはその理由を返す
+func applyAlertArgs(alert *Alert, args []string, units Units) error {
+	for i := 0; i < len(args); i++ {
+		word := strings.ToLower(args[i])
+		// 次の単語が値ならそれを使う
+		var value string
+		if i+1 < len(args) {
+			if _, isKind := alertKindWords[strings.ToLower(args[i+1])]; !isKind && !isWord(args[i+1], alertQuietWords) {
+				value = strings.TrimSuffix(strings.TrimRight(args[i+1], "%％℃℉"), "mph")
+			}
+		}
+		switch kind, ok := alertKindWords[word]; {
+		case ok:
+			if value != "" {
+				i++
+			}
+			if err := setThreshold(alert, kind, value, units); err != nil {
+				return err
+			}
+		case isWord(word, alertQuietWords):
+			if value == "" {
+				return fmt.Errorf("おやすみの時間は「おやすみ 22:00-07:00」のように送ってね")
+			}
+			i++
+			if isWord(value, alertOffWords) {
+				alert.QuietStart, alert.QuietEnd = nil, nil
+				continue
+			}
+			start, end, ok := parseTimeRange(value)
+			if !ok {
+				return fmt.Errorf("「%s」は時間として読めなかったよ。「22:00-07:00」のように送ってね", value)
+			}
+			alert.QuietStart, alert.QuietEnd = &start, &end
+		case isWord(word, alertOffWords):
+			if value != "" {
+				return fmt.Errorf("「%s」は警報の設定として読めなかったよ", args[i+1])
+			}
+			alert.RainProbability, alert.MinTemperature, alert.MaxWindSpeed = nil, nil, nil
+		default:
+			return fmt.Errorf("「%s」は警報の設定として読めなかったよ", args[i])
+		}
+	}
+	return nil
+}
+
+// setThreshold は kind の警報のしきい値を value にする
+// value は units の単位の値で、空のときは初期値に、オフのときは警報を送らないようにする
+func setThreshold(alert *Alert, kind AlertKind, value string, units Units) error {
+	if isWord(value, alertOffWords) {
+		switch kind {
+		case AlertRain:
+			alert.RainProbability = nil
+		case AlertCold:
+			alert.MinTemperature = nil
+		default:
+			alert.MaxWindSpeed = nil
+		}
+		return nil
+	}
+	v := math.NaN()
+	if value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("「%s」は数として読めなかったよ", value)
+		}
+		v = parsed
+	}
+	switch kind {
+	case AlertRain:
+		p := defaultRainProbability
+		if !math.IsNaN(v) {
+			if v < 0 || v > 100 {
+				return fmt.Errorf("降水確率は0から100の間で送ってね")
+			}
+			p = Percent(v)
+		}
+		alert.RainProbability = &p
+	case AlertCold:
+		t := defaultMinTemperature
+		if !math.IsNaN(v) {
+			t = units.celsius(v)
+		}
+		alert.MinTemperature = &t
+	default:
+		w := defaultMaxWindSpeed
+		if !math.IsNaN(v) {
+			if v <= 0 {
+				return fmt.Errorf("風速は0より大きい値で送ってね")
+			}
+			w = units.metersPerSecond(v)
+		}
+		alert.MaxWindSpeed = &w
+	}
+	return nil
+}
+
+// parseTimeRange は "22:00-07:00" を0時からの分の組にする
+func parseTimeRange(s string) (start, end int, ok bool) {
+	for _, sep := range []string{"-", "〜", "~", "－"} {
+		if from, to, found := strings.Cut(s, sep); found {
+			start, okStart := parseTimeOfDay(from)
+			end, okEnd := parseTimeOfDay(to)
+			return start, end, okStart && okEnd && start != end
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,35 @@
+package weather
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestAlertThresholdsUseUnits(t *testing.T) {
+	var alert Alert
+	if err := applyAlertArgs(&alert, []string{"気温", "32℉", "風", "22.4mph"}, Imperial); err != nil {
+		t.Fatal(err)
+	}
+	// しきい値は摂氏・メートル毎秒で保存する
+	if alert.MinTemperature == nil || math.Abs(float64(*alert.MinTemperature)) > 1e-9 {
+		t.Errorf("got min temperature %v, want 0℃", alert.MinTemperature)
+	}
+	if alert.MaxWindSpeed == nil || math.Abs(float64(*alert.MaxWindSpeed)-10) > 0.05 {
+		t.Errorf("got max wind speed %v, want about 10 m/s", alert.MaxWindSpeed)
+	}
+
+	// 表示するときは設定した単位系に直す
+	imperial := alert.describe(Imperial)
+	for _, want := range []string{"気温: 32℉ 未満", "風速 22.4 mph 以上"} {
+		if !strings.Contains(imperial, want) {
+			t.Errorf("got %q, want it to contain %q", imperial, want)
+		}
+	}
+	metric := alert.describe(Metric)
+	for _, want := range []string{"気温: 0℃ 未満", "風速 10 m/s 以上"} {
+		if !strings.Contains(metric, want) {
+			t.Errorf("got %q, want it to contain %q", metric, want)
+		}
+	}
+}
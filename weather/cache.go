@@ -0,0 +1,263 @@
+package weather
+
+import (
+	"context"
+	"expvar"
+	"math"
+	"sync"
+	"time"
+)
+
+// キャッシュと問い合わせの制限の統計
+// /debug/vars の "weather" で確認できる
+var metrics = expvar.NewMap("weather")
+
+const (
+	cacheHits      = "cache_hits"
+	cacheMisses    = "cache_misses"
+	cacheCoalesced = "cache_coalesced"
+	rateLimited    = "rate_limited"
+)
+
+// Intervals は Provider がそれぞれの情報を更新する間隔
+// Cache はこの間隔だけ結果を覚えておく
+type Intervals struct {
+	Current time.Duration
+	Hourly  time.Duration
+	Daily   time.Duration
+}
+
+// DefaultIntervals は更新間隔がわからない Provider に使う間隔
+var DefaultIntervals = Intervals{
+	Current: 10 * time.Minute,
+	Hourly:  time.Hour,
+	Daily:   time.Hour,
+}
+
+// UpdateIntervals はOpenWeatherMapAPIの更新間隔を返す
+// 現在の天気はおよそ10分ごと、予報は3時間ごとに更新される
+func (p *OpenWeatherMap) UpdateIntervals() Intervals {
+	return Intervals{
+		Current: 10 * time.Minute,
+		Hourly:  3 * time.Hour,
+		Daily:   3 * time.Hour,
+	}
+}
+
+// UpdateIntervals は気象庁の更新間隔を返す
+// アメダスは10分ごとに更新される。予報は1日3回(5時・11時・17時)だが、
+// 臨時に発表されることもあるので1時間で取得し直す
+func (p *JMA) UpdateIntervals() Intervals {
+	return Intervals{
+		Current: 10 * time.Minute,
+		Hourly:  time.Hour,
+		Daily:   time.Hour,
+	}
+}
+
+// CacheOption は Cache の設定を変える
+type CacheOption func(*Cache)
+
+// WithIntervals は結果を覚えておく時間を設定する
+// 初期値は Provider の UpdateIntervals、それがなければ DefaultIntervals
+func WithIntervals(intervals Intervals) CacheOption {
+	return func(c *Cache) {
+		c.intervals = intervals
+	}
+}
+
+// WithPrecision は同じ場所とみなすために緯度経度を丸める小数点以下の桁数を設定する
+// 初期値は2桁(およそ1km四方)
+func WithPrecision(digits int) CacheOption {
+	return func(c *Cache) {
+		c.scale = math.Pow10(digits)
+	}
+}
+
+// DailyFromHourly は1日ごとの天気予報を、数時間ごとの天気予報から作る Provider
+// Daily と Hourly が同じ問い合わせ先を使うときに実装すると、Cache はその問い合わせを1回にまとめる
+type DailyFromHourly interface {
+	DailyFromHourly(hourly *HourlyForecast) *DailyForecast
+}
+
+// dailyFromHourly は provider か、provider が包んでいる Provider (Unwrap で取り出す) の DailyFromHourly を返す
+func dailyFromHourly(provider Provider) (DailyFromHourly, bool) {
+	for {
+		if p, ok := provider.(DailyFromHourly); ok {
+			return p, true
+		}
+		wrapper, ok := provider.(interface{ Unwrap() Provider })
+		if !ok {
+			return nil, false
+		}
+		provider = wrapper.Unwrap()
+	}
+}
+
+// Cache は Provider の結果を覚えておく Provider
+//
+// 緯度経度を丸めた場所と問い合わせ先ごとに、Provider の更新間隔だけ結果を覚えておき、
+// 同じ問い合わせには覚えた結果を返す。同じ問い合わせが同時に来たときは Provider を1回だけ呼び出す。
+// Provider が DailyFromHourly を実装していれば、Daily は Hourly と同じ問い合わせの結果から作る。
+// エラーは覚えない。返す結果はほかの問い合わせと共有しているので、書き換えてはいけない
+type Cache struct {
+	provider  Provider
+	intervals Intervals
+	scale     float64
+	// daily は Hourly の結果から Daily を作る。nil のときは Provider の Daily を呼び出す
+	daily DailyFromHourly
+
+	mu       sync.Mutex
+	entries  map[cacheKey]*cacheEntry
+	inflight map[cacheKey]*flight
+}
+
+type cacheKey struct {
+	// endpoint は問い合わせ先 (Current, Hourly, Daily のどれを呼び出したか)
+	endpoint  string
+	latitude  float64
+	longitude float64
+}
+
+type cacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// flight は Provider に問い合わせ中の呼び出し
+// 同じ問い合わせは done が閉じられるのを待って結果を共有する
+type flight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+	// canceled は問い合わせた呼び出し元の ctx が終わったせいで失敗したか、
+	// Provider がパニックして結果がないかどうか。待っている呼び出しは自分で問い合わせ直す
+	// Provider はエラーを ProviderError に包むので、err ではなくこれで判定する
+	canceled bool
+}
+
+// 期限切れの結果を掃除するまでに覚えておく件数
+const cacheSweepSize = 1000
+
+// NewCache は provider の結果を覚えておく Cache をつくる
+func NewCache(provider Provider, opts ...CacheOption) *Cache {
+	c := &Cache{
+		provider:  provider,
+		intervals: DefaultIntervals,
+		scale:     100,
+		entries:   map[cacheKey]*cacheEntry{},
+		inflight:  map[cacheKey]*flight{},
+	}
+	if p, ok := provider.(interface{ UpdateIntervals() Intervals }); ok {
+		c.intervals = p.UpdateIntervals()
+	}
+	c.daily, _ = dailyFromHourly(provider)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Current は現在の天気を返す
+func (c *Cache) Current(ctx context.Context, at Coordinates) (*Conditions, error) {
+	return cached(c, ctx, "Current", c.intervals.Current, at, c.provider.Current)
+}
+
+// Hourly は数時間ごとの天気予報を返す
+func (c *Cache) Hourly(ctx context.Context, at Coordinates) (*HourlyForecast, error) {
+	return cached(c, ctx, "Hourly", c.intervals.Hourly, at, c.provider.Hourly)
+}
+
+// Daily は1日ごとの天気予報を返す
+// Hourly と同じ問い合わせ先を使う Provider では、Hourly の結果から作る
+func (c *Cache) Daily(ctx context.Context, at Coordinates) (*DailyForecast, error) {
+	if c.daily != nil {
+		hourly, err := c.Hourly(ctx, at)
+		if err != nil {
+			return nil, err
+		}
+		return c.daily.DailyFromHourly(hourly), nil
+	}
+	return cached(c, ctx, "Daily", c.intervals.Daily, at, c.provider.Daily)
+}
+
+// cached は覚えている結果があればそれを返し、なければ fetch を呼び出して結果を覚える
+func cached[T any](c *Cache, ctx context.Context, endpoint string, ttl time.Duration, at Coordinates, fetch func(context.Context, Coordinates) (*T, error)) (*T, error) {
+	at = c.round(at)
+	key := cacheKey{endpoint: endpoint, latitude: at.Latitude, longitude: at.Longitude}
+
+	c.mu.Lock()
+	for {
+		if entry, ok := c.entries[key]; ok && time.Now().Before(entry.expiresAt) {
+			c.mu.Unlock()
+			metrics.Add(cacheHits, 1)
+			return entry.value.(*T), nil
+		}
+		f, ok := c.inflight[key]
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+		metrics.Add(cacheCoalesced, 1)
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// 先に問い合わせた呼び出しが、その呼び出し元の都合で中断されたときは結果を共有せずに問い合わせ直す
+		if f.canceled {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			c.mu.Lock()
+			continue
+		}
+		if f.err != nil {
+			return nil, f.err
+		}
+		return f.value.(*T), nil
+	}
+	f := &flight{done: make(chan struct{})}
+	c.inflight[key] = f
+	c.mu.Unlock()
+	metrics.Add(cacheMisses, 1)
+
+	// fetch がパニックしても待っている呼び出しが止まったままにならないように、片付けは defer で必ず行う
+	// パニックしたときは結果がないので、canceled のままにして待っている呼び出しに問い合わせ直してもらう
+	f.canceled = true
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		if !f.canceled && f.err == nil {
+			c.store(key, f.value, time.Now().Add(ttl))
+		}
+		c.mu.Unlock()
+		close(f.done)
+	}()
+
+	value, err := fetch(ctx, at)
+	f.value, f.err = value, err
+	f.canceled = err != nil && ctx.Err() != nil
+	return value, err
+}
+
+// store は結果を覚える。c.mu を持って呼び出す
+func (c *Cache) store(key cacheKey, value interface{}, expiresAt time.Time) {
+	if len(c.entries) >= cacheSweepSize {
+		now := time.Now()
+		for k, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = &cacheEntry{value: value, expiresAt: expiresAt}
+}
+
+// round は緯度経度を設定された桁数に丸める
+func (c *Cache) round(at Coordinates) Coordinates {
+	return Coordinates{
+		Latitude:  math.Round(at.Latitude*c.scale) / c.scale,
+		Longitude: math.Round(at.Longitude*c.scale) / c.scale,
+	}
+}
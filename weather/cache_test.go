@@ -0,0 +1,186 @@
+package weather_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/weather"
+	"github.com/xxarupakaxx/sysad-linebot-handson/weather/weathertest"
+)
+
+var tokyo = weather.Coordinates{Latitude: 35.6895, Longitude: 139.6917}
+
+// blocking は release が閉じられるまで Current の問い合わせを止める Provider
+// 止まっている間に ctx が終わったら、本物の Provider と同じように ProviderError を返す
+type blocking struct {
+	*weathertest.Fake
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func newBlocking() *blocking {
+	return &blocking{Fake: weathertest.New(), started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (b *blocking) Current(ctx context.Context, at weather.Coordinates) (*weather.Conditions, error) {
+	b.once.Do(func() { close(b.started) })
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return nil, &weather.ProviderError{Provider: "blocking", Kind: weather.ErrUnavailable, Message: ctx.Err().Error()}
+	}
+	return b.Fake.Current(ctx, at)
+}
+
+func TestCacheCoalescesConcurrentLookups(t *testing.T) {
+	provider := newBlocking()
+	cache := weather.NewCache(provider)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	lookup := func() {
+		defer wg.Done()
+		// 同じ場所とみなす範囲で少しずらしても、問い合わせは1回になる
+		if _, err := cache.Current(context.Background(), weather.Coordinates{Latitude: tokyo.Latitude + 0.001, Longitude: tokyo.Longitude}); err != nil {
+			errs <- err
+		}
+	}
+	wg.Add(1)
+	go lookup()
+	<-provider.started
+	for i := 0; i < 9; i++ {
+		wg.Add(1)
+		go lookup()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(provider.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("lookup failed: %v", err)
+	}
+	if calls := provider.Calls("Current"); calls != 1 {
+		t.Errorf("got %d upstream calls, want 1", calls)
+	}
+}
+
+func TestCacheDoesNotShareLeaderCancellation(t *testing.T) {
+	provider := newBlocking()
+	cache := weather.NewCache(provider)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := cache.Current(ctx, tokyo)
+		leader <- err
+	}()
+	<-provider.started
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := cache.Current(context.Background(), tokyo)
+		waiter <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-leader; err == nil {
+		t.Error("leader succeeded after its context was canceled")
+	}
+	close(provider.release)
+	if err := <-waiter; err != nil {
+		t.Errorf("waiter got the leader's cancellation: %v", err)
+	}
+}
+
+// panicking は最初の Current の問い合わせで、started を閉じてから release を待ってパニックする Provider
+type panicking struct {
+	*blocking
+	calls int
+}
+
+func (p *panicking) Current(ctx context.Context, at weather.Coordinates) (*weather.Conditions, error) {
+	p.calls++
+	if p.calls == 1 {
+		p.once.Do(func() { close(p.started) })
+		<-p.release
+		panic("provider panicked")
+	}
+	return p.Fake.Current(ctx, at)
+}
+
+func TestCacheRecoversFromPanickingProvider(t *testing.T) {
+	provider := &panicking{blocking: newBlocking()}
+	cache := weather.NewCache(provider)
+
+	leader := make(chan interface{}, 1)
+	go func() {
+		// ワーカーと同じようにパニックを recover する
+		defer func() { leader <- recover() }()
+		cache.Current(context.Background(), tokyo)
+	}()
+	<-provider.started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := cache.Current(ctx, tokyo)
+		waiter <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(provider.release)
+	if r := <-leader; r == nil {
+		t.Error("leader did not panic")
+	}
+	// 待っていた呼び出しは自分で問い合わせ直す
+	if err := <-waiter; err != nil {
+		t.Errorf("waiter failed after the leader panicked: %v", err)
+	}
+	// 後から来た問い合わせも止まらない
+	if _, err := cache.Current(ctx, tokyo); err != nil {
+		t.Errorf("lookup after the panic failed: %v", err)
+	}
+}
+
+func TestCacheExpires(t *testing.T) {
+	fake := weathertest.New()
+	cache := weather.NewCache(fake, weather.WithIntervals(weather.Intervals{Current: 50 * time.Millisecond}))
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Current(context.Background(), tokyo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := fake.Calls("Current"); calls != 1 {
+		t.Fatalf("got %d upstream calls before expiry, want 1", calls)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := cache.Current(context.Background(), tokyo); err != nil {
+		t.Fatal(err)
+	}
+	if calls := fake.Calls("Current"); calls != 2 {
+		t.Errorf("got %d upstream calls after expiry, want 2", calls)
+	}
+}
+
+func TestCacheSharesForecastEndpoint(t *testing.T) {
+	fake := weathertest.New()
+	// トークンが1つしかなくても、Hourly と Daily は同じ /forecast の問い合わせ1回で済む
+	cache := weather.NewCache(weather.NewRateLimited(fake, 1, 1))
+
+	if _, err := cache.Hourly(context.Background(), tokyo); err != nil {
+		t.Fatal(err)
+	}
+	daily, err := cache.Daily(context.Background(), tokyo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(daily.Days) == 0 {
+		t.Error("got no days")
+	}
+	if hourly, daily := fake.Calls("Hourly"), fake.Calls("Daily"); hourly != 1 || daily != 0 {
+		t.Errorf("got %d Hourly and %d Daily upstream calls, want 1 and 0", hourly, daily)
+	}
+}
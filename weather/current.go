@@ -0,0 +1,118 @@
+// Package weather は天気確認機能
+// 天気の情報は Provider (OpenWeatherMapAPI や気象庁のJSON)から取得する
+package weather
+
+import (
+	"context"
+	"log"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+)
+
+// Client は Provider を使って天気を調べ、返信をつくる
+type Client struct {
+	provider      Provider
+	geocoder      Geocoder
+	subscriptions *SubscriptionStore
+	preferences   PreferenceStore
+}
+
+// ClientOption は Client の設定を変える
+type ClientOption func(*Client)
+
+// WithGeocoder は地名から場所を調べる Geocoder を設定する
+// 初期値は手元の一覧だけを使う Gazetteer
+func WithGeocoder(geocoder Geocoder) ClientOption {
+	return func(c *Client) {
+		c.geocoder = geocoder
+	}
+}
+
+// WithPreferences はユーザーごとの単位系などを保存する PreferenceStore を設定する
+// 初期値はメモリに保存する MemoryPreferenceStore
+func WithPreferences(store PreferenceStore) ClientOption {
+	return func(c *Client) {
+		c.preferences = store
+	}
+}
+
+// New は provider から天気の情報を取得する Client を作る
+func New(provider Provider, opts ...ClientOption) *Client {
+	c := &Client{provider: provider, geocoder: NewGazetteer(), preferences: NewMemoryPreferenceStore()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Forget は source (ユーザー・グループ・トークルーム) の天気予報の登録・警報・単位系の設定をすべて削除する
+// ブロックされたときやグループから退出させられたときに呼び出す
+func (c *Client) Forget(ctx context.Context, source *linebot.EventSource) {
+	sourceID := bot.SourceID(source)
+	if sourceID == "" {
+		return
+	}
+	if c.subscriptions != nil {
+		if err := c.subscriptions.Forget(ctx, sourceID); err != nil {
+			log.Printf("db error: %v", err)
+		}
+	}
+	if err := c.preferences.Forget(ctx, sourceID); err != nil {
+		log.Printf("db error: %v", err)
+	}
+}
+
+// CurrentHandler は送られてきた位置情報の現在の天気を返信する
+// クイックリプライで同じ場所の天気予報を選べる
+func (c *Client) CurrentHandler(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	location, ok := event.Message.(*linebot.LocationMessage)
+	if !ok {
+		return nil
+	}
+	at := Coordinates{Latitude: location.Latitude, Longitude: location.Longitude}
+	replyMessage, err := c.currentText(ctx, at, c.unitsFor(ctx, bot.SourceID(event.Source)))
+	if err != nil {
+		return errorReply(err)
+	}
+	return linebot.NewTextMessage(replyMessage).WithQuickReplies(viewQuickReplies("", at, nil))
+}
+
+// GetWeather は天気の情報の文字列を摂氏でつくる
+func (c *Client) GetWeather(ctx context.Context, location *linebot.LocationMessage) (string, error) {
+	text, err := c.currentText(ctx, Coordinates{Latitude: location.Latitude, Longitude: location.Longitude}, Metric)
+	if err != nil {
+		return ErrorMessage(err), err
+	}
+	return text, nil
+}
+
+// currentText は at の現在の天気を units の単位で文字列にする
+// 天気の説明の前にはアイコンに合った絵文字を付ける
+func (c *Client) currentText(ctx context.Context, at Coordinates, units Units) (string, error) {
+	conditions, err := c.provider.Current(ctx, at)
+	if err != nil {
+		return "", err
+	}
+
+	// 返信メッセージの作成
+	text := `現在の天気情報
+天気 : ` + describeWeather(conditions.Description, conditions.Icon) + `
+気温 : ` + units.Temperature(conditions.Temperature) + `
+湿度 : ` + formatPercent(conditions.Humidity) + `
+風速 : ` + units.WindSpeed(conditions.WindSpeed)
+
+	return text, nil
+}
+
+// unitsFor は sourceID が設定した単位系を返す
+// 設定を読めなかったときは摂氏にする
+func (c *Client) unitsFor(ctx context.Context, sourceID string) Units {
+	units, err := c.preferences.Units(ctx, sourceID)
+	if err != nil {
+		log.Printf("failed to load weather preferences: %v", err)
+		return Metric
+	}
+	return units
+}
@@ -0,0 +1,123 @@
+package weather
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// Provider が返すエラーの種類
+// errors.Is で判定できる
+var (
+	// ErrUnsupportedLocation はサービスが対応していない場所を指定したときのエラー
+	ErrUnsupportedLocation = errors.New("weather: location is not supported by the provider")
+	// ErrRateLimited は問い合わせの回数の上限に達したときのエラー
+	// しばらく待てばまた問い合わせられる
+	ErrRateLimited = errors.New("weather: too many requests to the provider, try again later")
+	// ErrUnauthorized はAPIキーが間違っているなど、サービスに問い合わせを断られたときのエラー
+	ErrUnauthorized = errors.New("weather: provider rejected the credentials")
+	// ErrUnavailable はサービスにつながらない、またはサービスの中でエラーが起きたときのエラー
+	ErrUnavailable = errors.New("weather: provider is unavailable")
+	// ErrInvalidResponse はサービスからのレスポンスが読めない、または足りないときのエラー
+	ErrInvalidResponse = errors.New("weather: invalid response from provider")
+)
+
+// ProviderError はサービスへの問い合わせに失敗したときのエラー
+// Kind はエラーの種類で、errors.Is(err, ErrUnauthorized) のように判定できる
+type ProviderError struct {
+	// Provider はサービスの名前 (openweathermap, jma)
+	Provider string
+	// Kind はエラーの種類 (ErrUnauthorized など)
+	Kind error
+	// StatusCode はサービスが返したステータスコード。レスポンスがなかったときは0
+	StatusCode int
+	// Message はサービスが返したエラーメッセージや、失敗した理由
+	Message string
+}
+
+func (e *ProviderError) Error() string {
+	// 例: weather: provider rejected the credentials (openweathermap, status 401): Invalid API key.
+	msg := fmt.Sprintf("%v (%s", e.Kind, e.Provider)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(", status %d", e.StatusCode)
+	}
+	msg += ")"
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Unwrap はエラーの種類を返す
+func (e *ProviderError) Unwrap() error {
+	return e.Kind
+}
+
+// statusError はステータスコードに合った種類の ProviderError をつくる
+func statusError(provider string, status int, message string) *ProviderError {
+	kind := ErrUnavailable
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		kind = ErrUnauthorized
+	case status == http.StatusTooManyRequests:
+		kind = ErrRateLimited
+	case status == http.StatusNotFound:
+		kind = ErrUnsupportedLocation
+	case status >= 400 && status < 500:
+		kind = ErrInvalidResponse
+	}
+	return &ProviderError{Provider: provider, Kind: kind, StatusCode: status, Message: message}
+}
+
+// requestError はサービスにリクエストを送れなかったときの ProviderError をつくる
+// http.Client のエラーはクエリ文字列 (APIキーの appid も入っている) を含むURLを持っているので、
+// ログにAPIキーが出ないように、URLはクエリを除いたものにする
+func requestError(provider string, err error) *ProviderError {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		target := urlErr.URL
+		if u, parseErr := url.Parse(urlErr.URL); parseErr == nil {
+			u.RawQuery, u.Fragment, u.User = "", "", nil
+			target = u.String()
+		} else {
+			target = "(invalid URL)"
+		}
+		return &ProviderError{Provider: provider, Kind: ErrUnavailable, Message: fmt.Sprintf("%s %s: %v", urlErr.Op, target, urlErr.Err)}
+	}
+	return &ProviderError{Provider: provider, Kind: ErrUnavailable, Message: err.Error()}
+}
+
+// invalidResponse はレスポンスが読めない、または足りないときの ProviderError をつくる
+func invalidResponse(provider, format string, args ...interface{}) *ProviderError {
+	return &ProviderError{Provider: provider, Kind: ErrInvalidResponse, Message: fmt.Sprintf(format, args...)}
+}
+
+// 問い合わせの回数の上限に達したときの返信
+const tryAgainLaterMessage = "いまは天気の問い合わせが混み合っているよ。少し時間をおいてからもう一度送ってね！"
+
+// ErrorMessage は天気を調べられなかった理由をユーザー向けの文章にする
+func ErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		return tryAgainLaterMessage
+	case errors.Is(err, ErrUnsupportedLocation):
+		return "ごめんね、その場所の天気はまだ調べられないよ..."
+	case errors.Is(err, ErrUnauthorized):
+		return "天気サービスの設定に問題があって天気を調べられなかったよ。Botの管理者に伝えてね"
+	case errors.Is(err, ErrUnavailable):
+		return "天気サービスにつながらなかったよ。少し時間をおいてからもう一度送ってね！"
+	case errors.Is(err, ErrInvalidResponse):
+		return "天気サービスから正しいデータが届かなかったよ。少し時間をおいてからもう一度送ってね！"
+	}
+	return "Botサーバーでエラーが発生しました"
+}
+
+// errorReply は天気を調べられなかったときの返信をつくる
+func errorReply(err error) linebot.SendingMessage {
+	log.Print(err)
+	return linebot.NewTextMessage(ErrorMessage(err))
+}
@@ -0,0 +1,34 @@
+package weather_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/weather"
+)
+
+// failingTransport はリクエストを送らずに失敗する http.RoundTripper
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestProviderErrorDoesNotContainAPIKey(t *testing.T) {
+	const appID = "secret-app-id"
+	provider := weather.NewOpenWeatherMap(appID, weather.WithHTTPClient(&http.Client{Transport: failingTransport{}}))
+
+	_, err := provider.Current(context.Background(), tokyo)
+	if !errors.Is(err, weather.ErrUnavailable) {
+		t.Fatalf("got %v, want ErrUnavailable", err)
+	}
+	if strings.Contains(err.Error(), appID) {
+		t.Errorf("got %q, want the API key to be removed", err.Error())
+	}
+	if !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("got %q, want the reason of the failure", err.Error())
+	}
+}
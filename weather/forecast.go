@@ -0,0 +1,245 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+)
+
+// WeekHandler は送られてきた位置情報の3日分の天気予報を返信する
+// クイックリプライで3時間ごとの予報や5日分の予報に切り替えられる
+func (c *Client) WeekHandler(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	location, ok := event.Message.(*linebot.LocationMessage)
+	if !ok {
+		return nil
+	}
+	at := Coordinates{Latitude: location.Latitude, Longitude: location.Longitude}
+	replyMessage, err := c.forecastMessage(ctx, at, DefaultView, c.unitsFor(ctx, bot.SourceID(event.Source)))
+	if err != nil {
+		// エラーのときに nil の *linebot.FlexMessage を返すと、nil ではない返信として送られてしまう
+		return errorReply(err)
+	}
+	return replyMessage.WithQuickReplies(viewQuickReplies("", at, &DefaultView))
+}
+
+// GetWeekWeather は天気予報のカルーセルを摂氏でつくる
+func (c *Client) GetWeekWeather(ctx context.Context, location *linebot.LocationMessage) (*linebot.FlexMessage, error) {
+	return c.forecastMessage(ctx, Coordinates{Latitude: location.Latitude, Longitude: location.Longitude}, DefaultView, Metric)
+}
+
+// forecastMessage は at の天気予報を view の見せ方、units の単位でカルーセルにする
+func (c *Client) forecastMessage(ctx context.Context, at Coordinates, view View, units Units) (*linebot.FlexMessage, error) {
+	if view.Hourly {
+		forecast, err := c.provider.Hourly(ctx, at)
+		if err != nil {
+			return nil, err
+		}
+		hours := *forecast
+		hours.Hours = upcoming(forecast, 24*time.Hour)
+		if len(hours.Hours) == 0 {
+			return nil, fmt.Errorf("%w: hourly forecast has no entries", ErrInvalidResponse)
+		}
+		return CreateHourlyCarouselMessage(&hours, units), nil
+	}
+
+	forecast, err := c.provider.Daily(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	if len(forecast.Days) <= view.From {
+		return nil, fmt.Errorf("%w: forecast has only %d days", ErrInvalidResponse, len(forecast.Days))
+	}
+	days := *forecast
+	days.Days = forecast.Days[view.From:]
+	if len(days.Days) > view.Days {
+		days.Days = days.Days[:view.Days]
+	}
+	return CreateWeatherCarouseMessage(&days, units), nil
+}
+
+// upcoming は forecast のうち、これから span の間の予報を返す
+// すでに過ぎた時間の予報は含めない
+func upcoming(forecast *HourlyForecast, span time.Duration) []Conditions {
+	hours := forecast.Hours
+	now := time.Now()
+	for len(hours) > 0 && !hours[0].Time.Add(forecast.Interval).After(now) {
+		hours = hours[1:]
+	}
+	// 古い予報しかないときは、あるものを見せる
+	if len(hours) == 0 {
+		hours = forecast.Hours
+	}
+	if n := int(span / forecast.Interval); forecast.Interval > 0 && len(hours) > n {
+		hours = hours[:n]
+	}
+	return hours
+}
+
+// CreateWeatherCarouseMessage は1日ごとの天気予報を1日1枚ずつ並べたカルーセルをつくる
+// 日付は予報した場所のタイムゾーンで数え、気温は units の単位で表す
+func CreateWeatherCarouseMessage(forecast *DailyForecast, units Units) *linebot.FlexMessage {
+	now := time.Now().In(forecast.Location)
+	bubbles := make([]*linebot.BubbleContainer, 0, len(forecast.Days))
+	for _, day := range forecast.Days {
+		header := dayLabel(day.Date, now) + "の天気"
+		if day.Partial {
+			header += " (" + coveredHours(day) + ")"
+		}
+		bubbles = append(bubbles, weatherBubble(header, day.Icon, []linebot.FlexComponent{
+			largeText("最高気温 : " + units.Temperature(day.TemperatureMax) + "\n"),
+			largeText("最低気温 : " + units.Temperature(day.TemperatureMin) + "\n"),
+			smallText("天気 : " + day.Description),
+			smallText("降水確率 : " + formatPercent(day.PrecipitationProbability)),
+			smallText("湿度 : " + formatPercent(day.Humidity)),
+		}))
+	}
+	return linebot.NewFlexMessage(
+		"Weather Information",
+		&linebot.CarouselContainer{
+			Type:     linebot.FlexContainerTypeCarousel,
+			Contents: bubbles,
+		},
+	)
+}
+
+// coveredHours は一部の時間の分しかない日の予報が何時から何時までのものかを「15時〜24時」の形で返す
+func coveredHours(day Day) string {
+	until := day.Until.Hour()
+	if until == 0 && day.Until.After(day.Date) {
+		until = 24
+	}
+	return fmt.Sprintf("%d時〜%d時", day.From.Hour(), until)
+}
+
+// CreateHourlyCarouselMessage は数時間ごとの天気予報を1枚ずつ並べたカルーセルをつくる
+// 気温・降水確率・風速・天気を表示し、気温と風速は units の単位で表す
+func CreateHourlyCarouselMessage(forecast *HourlyForecast, units Units) *linebot.FlexMessage {
+	bubbles := make([]*linebot.BubbleContainer, 0, len(forecast.Hours))
+	for _, hour := range forecast.Hours {
+		t := hour.Time.In(forecast.Location)
+		header := fmt.Sprintf("%d/%d(%s) %d時", t.Month(), t.Day(), weekdays[t.Weekday()], t.Hour())
+		bubbles = append(bubbles, weatherBubble(header, hour.Icon, []linebot.FlexComponent{
+			largeText("気温 : " + units.Temperature(hour.Temperature)),
+			largeText("降水確率 : " + formatPercent(hour.PrecipitationProbability)),
+			smallText("風速 : " + units.WindSpeed(hour.WindSpeed)),
+			smallText("天気 : " + hour.Description),
+		}))
+	}
+	return linebot.NewFlexMessage(
+		"Weather Information",
+		&linebot.CarouselContainer{
+			Type:     linebot.FlexContainerTypeCarousel,
+			Contents: bubbles,
+		},
+	)
+}
+
+// weatherBubble はカルーセルの1枚をつくる
+// 見出し・天気のアイコン・本文の順に並べる
+func weatherBubble(header, icon string, body []linebot.FlexComponent) *linebot.BubbleContainer {
+	bubble := &linebot.BubbleContainer{
+		Type:      linebot.FlexContainerTypeBubble,
+		Direction: linebot.FlexBubbleDirectionTypeLTR,
+		Header: &linebot.BoxComponent{
+			Type:   linebot.FlexComponentTypeBox,
+			Layout: linebot.FlexBoxLayoutTypeBaseline,
+			Contents: []linebot.FlexComponent{
+				&linebot.TextComponent{
+					Type:   linebot.FlexComponentTypeText,
+					Text:   header,
+					Size:   linebot.FlexTextSizeTypeLg,
+					Align:  linebot.FlexComponentAlignTypeCenter,
+					Weight: linebot.FlexTextWeightTypeBold,
+				},
+			},
+			CornerRadius: linebot.FlexComponentCornerRadiusTypeXxl,
+			BorderColor:  "#00bfff",
+		},
+		Body: &linebot.BoxComponent{
+			Type:        linebot.FlexComponentTypeBox,
+			Layout:      linebot.FlexBoxLayoutTypeVertical,
+			Contents:    body,
+			BorderColor: "#5cd8f7",
+		},
+		Styles: &linebot.BubbleStyle{
+			Header: &linebot.BlockStyle{
+				Separator:      true,
+				SeparatorColor: "#2196F3",
+			},
+			Hero: &linebot.BlockStyle{
+				Separator:      true,
+				SeparatorColor: "#2196F3",
+			},
+			Body: &linebot.BlockStyle{
+				Separator:      true,
+				SeparatorColor: "#37474F",
+			},
+			Footer: &linebot.BlockStyle{
+				Separator:      true,
+				SeparatorColor: "#2196F3",
+			},
+		},
+	}
+	// アイコンがわからないときは画像を載せない
+	if icon != "" {
+		bubble.Hero = &linebot.ImageComponent{
+			Type:        linebot.FlexComponentTypeImage,
+			URL:         ConvertWeatherImage(icon),
+			Size:        linebot.FlexImageSizeTypeXxl,
+			AspectRatio: linebot.FlexImageAspectRatioType1to1,
+			AspectMode:  linebot.FlexImageAspectModeTypeFit,
+		}
+	}
+	return bubble
+}
+
+// largeText は本文の大きな文字の行をつくる
+func largeText(text string) *linebot.TextComponent {
+	return &linebot.TextComponent{
+		Type:     linebot.FlexComponentTypeText,
+		Text:     text,
+		Flex:     linebot.IntPtr(1),
+		Size:     linebot.FlexTextSizeTypeXl,
+		Wrap:     true,
+		MaxLines: linebot.IntPtr(2),
+	}
+}
+
+// smallText は本文の小さな文字の行をつくる
+func smallText(text string) *linebot.TextComponent {
+	return &linebot.TextComponent{
+		Type:     linebot.FlexComponentTypeText,
+		Text:     text,
+		Flex:     linebot.IntPtr(6),
+		Size:     linebot.FlexTextSizeTypeSm,
+		Wrap:     true,
+		MaxLines: linebot.IntPtr(10),
+	}
+}
+
+// ConvertWeatherImage は天気アイコンの画像URLをつくる
+func ConvertWeatherImage(pngNumber string) string {
+	return fmt.Sprintf("https://openweathermap.org/img/w/%s.png", pngNumber)
+}
+
+var weekdays = [...]string{"日", "月", "火", "水", "木", "金", "土"}
+
+// dayLabel は date を「今日 2/20(月)」のような見出しにする
+// 今日・明日・明後日以外は日付だけにする
+func dayLabel(date, now time.Time) string {
+	label := fmt.Sprintf("%d/%d(%s)", date.Month(), date.Day(), weekdays[date.Weekday()])
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, date.Location())
+	switch int(date.Sub(today).Hours() / 24) {
+	case 0:
+		return "今日 " + label
+	case 1:
+		return "明日 " + label
+	case 2:
+		return "明後日 " + label
+	}
+	return label
+}
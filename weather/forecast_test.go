@@ -0,0 +1,52 @@
+package weather_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/weather"
+	"github.com/xxarupakaxx/sysad-linebot-handson/weather/weathertest"
+)
+
+// フィクスチャは 2023-02-20 15:00 (日本時間) から3時間ごと5日分なので、
+// 初日は15時からの一部だけになり、途中で終わる最後の日 (2/25) は含めない
+func TestDailyGroupsByLocalDate(t *testing.T) {
+	forecast, err := weathertest.New().Daily(context.Background(), tokyo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forecast.Days) != 5 {
+		t.Fatalf("got %d days, want 5", len(forecast.Days))
+	}
+	jst := time.FixedZone("JST", 9*60*60)
+	for i, day := range forecast.Days {
+		want := time.Date(2023, 2, 20+i, 0, 0, 0, 0, jst)
+		if !day.Date.Equal(want) {
+			t.Errorf("day %d: got %v, want %v", i, day.Date, want)
+		}
+		if _, offset := day.Date.Zone(); offset != 9*60*60 {
+			t.Errorf("day %d: got offset %d, want JST", i, offset)
+		}
+		if day.Partial != (i == 0) {
+			t.Errorf("day %d: got partial %v", i, day.Partial)
+		}
+	}
+	first := forecast.Days[0]
+	if !first.From.Equal(time.Date(2023, 2, 20, 15, 0, 0, 0, jst)) || !first.Until.Equal(time.Date(2023, 2, 21, 0, 0, 0, 0, jst)) {
+		t.Errorf("got first day from %v until %v, want 15:00 until midnight", first.From, first.Until)
+	}
+
+	data, err := json.Marshal(weather.CreateWeatherCarouseMessage(forecast, weather.Metric))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "時〜"); n != 1 {
+		t.Errorf("got %d headers with covered hours, want 1", n)
+	}
+	if !strings.Contains(string(data), "2/20(月)の天気 (15時〜24時)") {
+		t.Errorf("the first header does not show the covered hours: %s", data)
+	}
+}
@@ -0,0 +1,145 @@
+package weather
+
+// japanesePlace は Gazetteer の一覧に入れる場所
+type japanesePlace struct {
+	name      string
+	region    string
+	romaji    string
+	latitude  float64
+	longitude float64
+}
+
+// 都道府県と主な市区の一覧
+// 都道府県の緯度経度は県庁の所在地
+var japanesePlaces = []japanesePlace{
+	// 都道府県
+	{"北海道", "北海道", "hokkaido", 43.064, 141.347},
+	{"青森県", "青森県", "aomori", 40.824, 140.740},
+	{"岩手県", "岩手県", "iwate", 39.704, 141.153},
+	{"宮城県", "宮城県", "miyagi", 38.269, 140.872},
+	{"秋田県", "秋田県", "akita", 39.719, 140.102},
+	{"山形県", "山形県", "yamagata", 38.240, 140.363},
+	{"福島県", "福島県", "fukushima", 37.750, 140.468},
+	{"茨城県", "茨城県", "ibaraki", 36.342, 140.447},
+	{"栃木県", "栃木県", "tochigi", 36.566, 139.884},
+	{"群馬県", "群馬県", "gunma", 36.391, 139.061},
+	{"埼玉県", "埼玉県", "saitama", 35.857, 139.649},
+	{"千葉県", "千葉県", "chiba", 35.605, 140.123},
+	{"東京都", "東京都", "tokyo", 35.690, 139.692},
+	{"神奈川県", "神奈川県", "kanagawa", 35.448, 139.643},
+	{"新潟県", "新潟県", "niigata", 37.902, 139.023},
+	{"富山県", "富山県", "toyama", 36.695, 137.211},
+	{"石川県", "石川県", "ishikawa", 36.594, 136.626},
+	{"福井県", "福井県", "fukui", 36.065, 136.222},
+	{"山梨県", "山梨県", "yamanashi", 35.664, 138.568},
+	{"長野県", "長野県", "nagano", 36.651, 138.181},
+	{"岐阜県", "岐阜県", "gifu", 35.391, 136.722},
+	{"静岡県", "静岡県", "shizuoka", 34.977, 138.383},
+	{"愛知県", "愛知県", "aichi", 35.180, 136.907},
+	{"三重県", "三重県", "mie", 34.730, 136.509},
+	{"滋賀県", "滋賀県", "shiga", 35.004, 135.868},
+	{"京都府", "京都府", "kyoto", 35.021, 135.756},
+	{"大阪府", "大阪府", "osaka", 34.686, 135.520},
+	{"兵庫県", "兵庫県", "hyogo", 34.691, 135.183},
+	{"奈良県", "奈良県", "nara", 34.685, 135.833},
+	{"和歌山県", "和歌山県", "wakayama", 34.226, 135.168},
+	{"鳥取県", "鳥取県", "tottori", 35.504, 134.238},
+	{"島根県", "島根県", "shimane", 35.472, 133.051},
+	{"岡山県", "岡山県", "okayama", 34.662, 133.935},
+	{"広島県", "広島県", "hiroshima", 34.397, 132.460},
+	{"山口県", "山口県", "yamaguchi", 34.186, 131.471},
+	{"徳島県", "徳島県", "tokushima", 34.066, 134.559},
+	{"香川県", "香川県", "kagawa", 34.340, 134.043},
+	{"愛媛県", "愛媛県", "ehime", 33.842, 132.766},
+	{"高知県", "高知県", "kochi", 33.560, 133.531},
+	{"福岡県", "福岡県", "fukuoka", 33.607, 130.418},
+	{"佐賀県", "佐賀県", "saga", 33.249, 130.299},
+	{"長崎県", "長崎県", "nagasaki", 32.745, 129.874},
+	{"熊本県", "熊本県", "kumamoto", 32.790, 130.742},
+	{"大分県", "大分県", "oita", 33.238, 131.613},
+	{"宮崎県", "宮崎県", "miyazaki", 31.911, 131.424},
+	{"鹿児島県", "鹿児島県", "kagoshima", 31.560, 130.558},
+	{"沖縄県", "沖縄県", "okinawa", 26.212, 127.681},
+
+	// 主な市区
+	{"札幌市", "北海道", "sapporo", 43.062, 141.354},
+	{"函館市", "北海道", "hakodate", 41.769, 140.729},
+	{"旭川市", "北海道", "asahikawa", 43.771, 142.365},
+	{"釧路市", "北海道", "kushiro", 42.985, 144.381},
+	{"帯広市", "北海道", "obihiro", 42.924, 143.196},
+	{"伊達市", "北海道", "date", 42.472, 140.865},
+	{"青森市", "青森県", "aomori", 40.822, 140.747},
+	{"盛岡市", "岩手県", "morioka", 39.702, 141.154},
+	{"仙台市", "宮城県", "sendai", 38.268, 140.870},
+	{"秋田市", "秋田県", "akita", 39.720, 140.103},
+	{"山形市", "山形県", "yamagata", 38.255, 140.340},
+	{"福島市", "福島県", "fukushima", 37.761, 140.474},
+	{"郡山市", "福島県", "koriyama", 37.400, 140.360},
+	{"いわき市", "福島県", "iwaki", 37.050, 140.888},
+	{"伊達市", "福島県", "date", 37.819, 140.563},
+	{"水戸市", "茨城県", "mito", 36.366, 140.471},
+	{"つくば市", "茨城県", "tsukuba", 36.083, 140.076},
+	{"宇都宮市", "栃木県", "utsunomiya", 36.555, 139.883},
+	{"前橋市", "群馬県", "maebashi", 36.389, 139.063},
+	{"高崎市", "群馬県", "takasaki", 36.322, 139.003},
+	{"さいたま市", "埼玉県", "saitama", 35.862, 139.646},
+	{"川越市", "埼玉県", "kawagoe", 35.925, 139.486},
+	{"千葉市", "千葉県", "chiba", 35.607, 140.106},
+	{"船橋市", "千葉県", "funabashi", 35.695, 139.983},
+	{"新宿区", "東京都", "shinjuku", 35.694, 139.703},
+	{"渋谷区", "東京都", "shibuya", 35.664, 139.698},
+	{"八王子市", "東京都", "hachioji", 35.666, 139.316},
+	{"府中市", "東京都", "fuchu", 35.669, 139.478},
+	{"町田市", "東京都", "machida", 35.548, 139.447},
+	{"横浜市", "神奈川県", "yokohama", 35.444, 139.638},
+	{"川崎市", "神奈川県", "kawasaki", 35.531, 139.703},
+	{"相模原市", "神奈川県", "sagamihara", 35.571, 139.373},
+	{"鎌倉市", "神奈川県", "kamakura", 35.319, 139.547},
+	{"新潟市", "新潟県", "niigata", 37.916, 139.036},
+	{"富山市", "富山県", "toyama", 36.696, 137.214},
+	{"金沢市", "石川県", "kanazawa", 36.561, 136.657},
+	{"福井市", "福井県", "fukui", 36.064, 136.220},
+	{"甲府市", "山梨県", "kofu", 35.662, 138.568},
+	{"長野市", "長野県", "nagano", 36.649, 138.195},
+	{"松本市", "長野県", "matsumoto", 36.238, 137.972},
+	{"岐阜市", "岐阜県", "gifu", 35.423, 136.761},
+	{"静岡市", "静岡県", "shizuoka", 34.976, 138.383},
+	{"浜松市", "静岡県", "hamamatsu", 34.711, 137.726},
+	{"名古屋市", "愛知県", "nagoya", 35.181, 136.906},
+	{"豊田市", "愛知県", "toyota", 35.083, 137.156},
+	{"津市", "三重県", "tsu", 34.718, 136.506},
+	{"四日市市", "三重県", "yokkaichi", 34.965, 136.624},
+	{"大津市", "滋賀県", "otsu", 35.018, 135.855},
+	{"京都市", "京都府", "kyoto", 35.012, 135.768},
+	{"大阪市", "大阪府", "osaka", 34.694, 135.502},
+	{"堺市", "大阪府", "sakai", 34.573, 135.483},
+	{"神戸市", "兵庫県", "kobe", 34.690, 135.196},
+	{"姫路市", "兵庫県", "himeji", 34.816, 134.686},
+	{"奈良市", "奈良県", "nara", 34.685, 135.805},
+	{"和歌山市", "和歌山県", "wakayama", 34.230, 135.171},
+	{"鳥取市", "鳥取県", "tottori", 35.501, 134.235},
+	{"松江市", "島根県", "matsue", 35.468, 133.049},
+	{"岡山市", "岡山県", "okayama", 34.655, 133.919},
+	{"倉敷市", "岡山県", "kurashiki", 34.585, 133.772},
+	{"広島市", "広島県", "hiroshima", 34.385, 132.455},
+	{"府中市", "広島県", "fuchu", 34.568, 133.237},
+	{"福山市", "広島県", "fukuyama", 34.486, 133.362},
+	{"山口市", "山口県", "yamaguchi", 34.178, 131.474},
+	{"下関市", "山口県", "shimonoseki", 33.958, 130.941},
+	{"徳島市", "徳島県", "tokushima", 34.070, 134.555},
+	{"高松市", "香川県", "takamatsu", 34.343, 134.046},
+	{"松山市", "愛媛県", "matsuyama", 33.840, 132.766},
+	{"高知市", "高知県", "kochi", 33.559, 133.531},
+	{"福岡市", "福岡県", "fukuoka", 33.590, 130.402},
+	{"北九州市", "福岡県", "kitakyushu", 33.883, 130.875},
+	{"久留米市", "福岡県", "kurume", 33.319, 130.508},
+	{"佐賀市", "佐賀県", "saga", 33.263, 130.301},
+	{"長崎市", "長崎県", "nagasaki", 32.750, 129.878},
+	{"佐世保市", "長崎県", "sasebo", 33.180, 129.715},
+	{"熊本市", "熊本県", "kumamoto", 32.803, 130.708},
+	{"大分市", "大分県", "oita", 33.240, 131.613},
+	{"宮崎市", "宮崎県", "miyazaki", 31.908, 131.420},
+	{"鹿児島市", "鹿児島県", "kagoshima", 31.597, 130.557},
+	{"那覇市", "沖縄県", "naha", 26.212, 127.679},
+	{"石垣市", "沖縄県", "ishigaki", 24.341, 124.156},
+}
@@ -0,0 +1,129 @@
+package weather
+
+import (
+	"context"
+	"strings"
+)
+
+// Place は地名から調べた場所
+type Place struct {
+	// Name は場所の名前 (例: 札幌市)
+	Name string
+	// Region は場所が含まれる都道府県や州の名前 (例: 北海道)
+	// 都道府県そのものを表すときは Name と同じになる
+	Region string
+	Coordinates
+}
+
+// FullName は都道府県と合わせた場所の名前を返す (例: 北海道札幌市)
+func (p Place) FullName() string {
+	if p.Region == "" || p.Region == p.Name {
+		return p.Name
+	}
+	return p.Region + p.Name
+}
+
+// Geocoder は地名から場所を調べる
+type Geocoder interface {
+	// Geocode は query に当てはまる場所をすべて返す
+	// 見つからなかったときは空のスライスを返す
+	Geocode(ctx context.Context, query string) ([]Place, error)
+}
+
+// Geocoders は順に問い合わせて、最初に見つかった結果を返す Geocoder
+// 手元の一覧で見つからない地名だけオンラインのサービスに問い合わせるときに使う
+type Geocoders []Geocoder
+
+// Geocode は場所が見つかるまで順に問い合わせる
+func (g Geocoders) Geocode(ctx context.Context, query string) ([]Place, error) {
+	for _, geocoder := range g {
+		places, err := geocoder.Geocode(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		if len(places) > 0 {
+			return places, nil
+		}
+	}
+	return nil, nil
+}
+
+// Gazetteer はネットワークを使わずに、手元の一覧から地名を調べる Geocoder
+// 一覧には都道府県と主な市区が入っていて、漢字・ローマ字のどちらでも調べられる
+type Gazetteer struct {
+	places []gazetteerPlace
+}
+
+type gazetteerPlace struct {
+	Place
+	// keys は当てはまる地名の書き方 (「札幌市」「札幌」「北海道札幌」「sapporo」など)
+	keys []string
+}
+
+// NewGazetteer は日本の都道府県と主な市区の一覧を使う Gazetteer をつくる
+func NewGazetteer() *Gazetteer {
+	g := &Gazetteer{}
+	for _, p := range japanesePlaces {
+		place := Place{
+			Name:        p.name,
+			Region:      p.region,
+			Coordinates: Coordinates{Latitude: p.latitude, Longitude: p.longitude},
+		}
+		name, region := trimSuffix(p.name), trimSuffix(p.region)
+		keys := []string{p.name, name, p.romaji}
+		if p.region != p.name {
+			keys = append(keys, p.region+p.name, p.region+name, region+p.name, region+name)
+		}
+		g.places = append(g.places, gazetteerPlace{Place: place, keys: keys})
+	}
+	return g
+}
+
+// Geocode は一覧から query に当てはまる場所を返す
+// 都道府県とその中の市が両方当てはまるとき (「静岡」なら静岡県と静岡市) は市だけを返す
+func (g *Gazetteer) Geocode(ctx context.Context, query string) ([]Place, error) {
+	query = normalizePlaceName(query)
+	if query == "" {
+		return nil, nil
+	}
+	var matches []Place
+	for _, p := range g.places {
+		for _, key := range p.keys {
+			if normalizePlaceName(key) == query {
+				matches = append(matches, p.Place)
+				break
+			}
+		}
+	}
+
+	cityRegions := map[string]bool{}
+	for _, p := range matches {
+		if p.Region != p.Name {
+			cityRegions[p.Region] = true
+		}
+	}
+	places := make([]Place, 0, len(matches))
+	for _, p := range matches {
+		if p.Region == p.Name && cityRegions[p.Region] {
+			continue
+		}
+		places = append(places, p)
+	}
+	return places, nil
+}
+
+// normalizePlaceName は地名を比べやすいように空白を除き、小文字にする
+func normalizePlaceName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), ""))
+}
+
+// trimSuffix は「都」「道」「府」「県」「市」「区」を取り除いた地名を返す
+// 「津市」は「津」になる
+func trimSuffix(name string) string {
+	for _, suffix := range []string{"都", "道", "府", "県", "市", "区"} {
+		if trimmed := strings.TrimSuffix(name, suffix); trimmed != name && trimmed != "" {
+			return trimmed
+		}
+	}
+	return name
+}
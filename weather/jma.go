@@ -0,0 +1,455 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jst は日本標準時。気象庁の予報はすべて日本時間で発表される
+var jst = time.FixedZone("JST", 9*60*60)
+
+// 予報を発表する地方の代表地点からこれ以上離れた場所は日本国外として扱う(km)
+const jmaMaxDistance = 300
+
+// 現在の天気に使うアメダスの観測所を探す範囲(km)
+const amedasMaxDistance = 50
+
+// JMA は気象庁のJSONを使う Provider
+// 天気予報は https://www.jma.go.jp/bosai/forecast/ 、現在の天気はアメダスの観測値を使う
+// APIキーは不要だが、日本国内の場所にしか対応していない
+type JMA struct {
+	*options
+
+	// アメダスの観測所の一覧。一度読み込んだら使い回す
+	mu       sync.Mutex
+	stations map[string]amedasStation
+}
+
+// NewJMA は気象庁のJSONを使う JMA をつくる
+func NewJMA(opts ...Option) *JMA {
+	return &JMA{options: newOptions("https://www.jma.go.jp", opts)}
+}
+
+// 天気予報で帰ってくる形式 (1)
+// 1つ目が3日間の予報、2つ目が1週間の予報
+type jmaForecast []struct {
+	TimeSeries []jmaTimeSeries `json:"timeSeries"`
+}
+
+// 天気予報で帰ってくる形式 (2)
+type jmaTimeSeries struct {
+	TimeDefines []time.Time `json:"timeDefines"`
+	Areas       []jmaArea   `json:"areas"`
+}
+
+// 天気予報で帰ってくる形式 (3)
+// 値はすべて文字列で、発表されていないものは空文字列になる
+type jmaArea struct {
+	Area struct {
+		Name string `json:"name"`
+		Code string `json:"code"`
+	} `json:"area"`
+	WeatherCodes []string `json:"weatherCodes"`
+	Weathers     []string `json:"weathers"`
+	Pops         []string `json:"pops"`
+	Temps        []string `json:"temps"`
+	TempsMin     []string `json:"tempsMin"`
+	TempsMax     []string `json:"tempsMax"`
+}
+
+// アメダスの観測所の一覧で帰ってくる形式
+// 緯度経度は [度, 分] で表される
+type amedasStation struct {
+	Lat    [2]float64 `json:"lat"`
+	Lon    [2]float64 `json:"lon"`
+	KjName string     `json:"kjName"`
+}
+
+// アメダスの観測値で帰ってくる形式
+// 値は [観測値, 品質情報] で表され、品質情報が0のときだけ正常な値
+type amedasObservation struct {
+	Temp     []float64 `json:"temp"`
+	Humidity []float64 `json:"humidity"`
+	Wind     []float64 `json:"wind"`
+}
+
+// Current は一番近いアメダスの観測所の現在の気温・湿度・風速と、今日の天気予報の天気を返す
+func (p *JMA) Current(ctx context.Context, at Coordinates) (*Conditions, error) {
+	daily, err := p.Daily(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	conditions := Conditions{
+		Time:                     time.Now().In(jst),
+		Temperature:              Celsius(Unknown),
+		Humidity:                 Percent(Unknown),
+		PrecipitationProbability: Percent(Unknown),
+		WindSpeed:                MetersPerSecond(Unknown),
+	}
+	if len(daily.Days) > 0 {
+		conditions.Description = daily.Days[0].Description
+		conditions.Icon = daily.Days[0].Icon
+		conditions.PrecipitationProbability = daily.Days[0].PrecipitationProbability
+	}
+
+	observedAt, observations, err := p.latestObservations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conditions.Time = observedAt
+	stations, err := p.amedasStations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 気温を観測している一番近い観測所を使う
+	for _, id := range nearestStations(stations, at) {
+		observation, ok := observations[id]
+		if !ok || !valid(observation.Temp) {
+			continue
+		}
+		conditions.Temperature = Celsius(observation.Temp[0])
+		if valid(observation.Humidity) {
+			conditions.Humidity = Percent(observation.Humidity[0])
+		}
+		if valid(observation.Wind) {
+			conditions.WindSpeed = MetersPerSecond(observation.Wind[0])
+		}
+		break
+	}
+	return &conditions, nil
+}
+
+// Hourly は3日間の予報にある6時間ごとの降水確率を返す
+// 気温・湿度・風速は発表されないので Unknown になる
+func (p *JMA) Hourly(ctx context.Context, at Coordinates) (*HourlyForecast, error) {
+	data, err := p.forecast(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	days := jmaDays(data)
+	forecast := &HourlyForecast{Location: jst, Interval: 6 * time.Hour}
+	if len(data) == 0 {
+		return forecast, nil
+	}
+	for _, series := range data[0].TimeSeries {
+		if len(series.Areas) == 0 || series.Areas[0].Pops == nil {
+			continue
+		}
+		area := series.Areas[0]
+		for i, t := range series.TimeDefines {
+			conditions := Conditions{
+				Time:                     t.In(jst),
+				Temperature:              Celsius(Unknown),
+				Humidity:                 Percent(Unknown),
+				PrecipitationProbability: Percent(number(area.Pops, i)),
+				WindSpeed:                MetersPerSecond(Unknown),
+			}
+			if day, ok := days[dateKey(t)]; ok {
+				conditions.Description = day.Description
+				conditions.Icon = day.Icon
+			}
+			forecast.Hours = append(forecast.Hours, conditions)
+		}
+	}
+	return forecast, nil
+}
+
+// Daily は3日間の予報と1週間の予報を合わせて1日ごとの予報を返す
+// 両方に含まれる日は3日間の予報を優先する
+func (p *JMA) Daily(ctx context.Context, at Coordinates) (*DailyForecast, error) {
+	data, err := p.forecast(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	days := jmaDays(data)
+	forecast := &DailyForecast{Location: jst, Days: make([]Day, 0, len(days))}
+	for _, day := range days {
+		forecast.Days = append(forecast.Days, *day)
+	}
+	sort.Slice(forecast.Days, func(i, j int) bool {
+		return forecast.Days[i].Date.Before(forecast.Days[j].Date)
+	})
+	return forecast, nil
+}
+
+// jmaDays は予報に含まれる値を日付ごとにまとめる
+// それぞれの予報の最初の地域(府県の代表の地域・地点)の値を使う
+func jmaDays(data jmaForecast) map[string]*Day {
+	days := map[string]*Day{}
+	dayOf := func(t time.Time) *Day {
+		key := dateKey(t)
+		if day, ok := days[key]; ok {
+			return day
+		}
+		day := &Day{
+			Date:                     startOfDay(t.In(jst)),
+			TemperatureMin:           Celsius(Unknown),
+			TemperatureMax:           Celsius(Unknown),
+			Humidity:                 Percent(Unknown),
+			PrecipitationProbability: Percent(Unknown),
+			WindSpeed:                MetersPerSecond(Unknown),
+		}
+		days[key] = day
+		return day
+	}
+
+	for _, report := range data {
+		for _, series := range report.TimeSeries {
+			if len(series.Areas) == 0 {
+				continue
+			}
+			area := series.Areas[0]
+			for i, t := range series.TimeDefines {
+				day := dayOf(t)
+				if text := field(area.Weathers, i); text != "" && day.Description == "" {
+					day.Description = strings.Join(strings.Fields(text), " ")
+				}
+				if code := field(area.WeatherCodes, i); code != "" {
+					if day.Description == "" {
+						day.Description = jmaDescription(code)
+					}
+					if day.Icon == "" {
+						day.Icon = jmaIcon(code)
+					}
+				}
+				if pop := Percent(number(area.Pops, i)); Known(pop) && (!Known(day.PrecipitationProbability) || pop > day.PrecipitationProbability) {
+					day.PrecipitationProbability = pop
+				}
+				// 3日間の予報の気温は0時が朝の最低気温、9時が日中の最高気温
+				if temp := Celsius(number(area.Temps, i)); Known(temp) {
+					if t.In(jst).Hour() == 0 && !Known(day.TemperatureMin) {
+						day.TemperatureMin = temp
+					} else if t.In(jst).Hour() != 0 && !Known(day.TemperatureMax) {
+						day.TemperatureMax = temp
+					}
+				}
+				if temp := Celsius(number(area.TempsMin, i)); Known(temp) && !Known(day.TemperatureMin) {
+					day.TemperatureMin = temp
+				}
+				if temp := Celsius(number(area.TempsMax, i)); Known(temp) && !Known(day.TemperatureMax) {
+					day.TemperatureMax = temp
+				}
+			}
+		}
+	}
+	return days
+}
+
+// forecast は at に一番近い地方の天気予報を取得する
+func (p *JMA) forecast(ctx context.Context, at Coordinates) (jmaForecast, error) {
+	office, ok := nearestOffice(at)
+	if !ok {
+		return nil, ErrUnsupportedLocation
+	}
+	var data jmaForecast
+	if err := p.getJSON(ctx, "/bosai/forecast/data/forecast/"+office.code+".json", &data); err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || len(data[0].TimeSeries) == 0 {
+		return nil, invalidResponse(JMAProvider, "forecast for %s has no time series", office.code)
+	}
+	return data, nil
+}
+
+// latestObservations は最新のアメダスの観測値を取得する
+func (p *JMA) latestObservations(ctx context.Context) (time.Time, map[string]amedasObservation, error) {
+	body, err := p.get(ctx, "/bosai/amedas/data/latest_time.txt")
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	latest, err := time.Parse(time.RFC3339, strings.TrimSpace(string(body)))
+	if err != nil {
+		return time.Time{}, nil, invalidResponse(JMAProvider, "invalid amedas latest time %q", body)
+	}
+	latest = latest.In(jst)
+
+	var observations map[string]amedasObservation
+	if err := p.getJSON(ctx, "/bosai/amedas/data/map/"+latest.Format("20060102150405")+".json", &observations); err != nil {
+		return time.Time{}, nil, err
+	}
+	return latest, observations, nil
+}
+
+// amedasStations はアメダスの観測所の一覧を返す
+func (p *JMA) amedasStations(ctx context.Context) (map[string]amedasStation, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stations != nil {
+		return p.stations, nil
+	}
+	var stations map[string]amedasStation
+	if err := p.getJSON(ctx, "/bosai/amedas/const/amedastable.json", &stations); err != nil {
+		return nil, err
+	}
+	p.stations = stations
+	return stations, nil
+}
+
+func (p *JMA) getJSON(ctx context.Context, path string, v interface{}) error {
+	body, err := p.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return invalidResponse(JMAProvider, "failed to decode %s: %v", path, err)
+	}
+	return nil
+}
+
+// get は気象庁のサーバの path にリクエストしてレスポンスを返す
+func (p *JMA) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, requestError(JMAProvider, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, statusError(JMAProvider, res.StatusCode, path)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, &ProviderError{Provider: JMAProvider, Kind: ErrUnavailable, Message: err.Error()}
+	}
+	return body, nil
+}
+
+// nearestOffice は at に一番近い地方を返す
+func nearestOffice(at Coordinates) (jmaOffice, bool) {
+	var nearest jmaOffice
+	best := math.Inf(1)
+	for _, office := range jmaOffices {
+		if d := distance(at, Coordinates{office.latitude, office.longitude}); d < best {
+			nearest, best = office, d
+		}
+	}
+	return nearest, best <= jmaMaxDistance
+}
+
+// nearestStations は at から amedasMaxDistance 以内の観測所を近い順に返す
+func nearestStations(stations map[string]amedasStation, at Coordinates) []string {
+	type candidate struct {
+		id       string
+		distance float64
+	}
+	var candidates []candidate
+	for id, station := range stations {
+		position := Coordinates{
+			Latitude:  station.Lat[0] + station.Lat[1]/60,
+			Longitude: station.Lon[0] + station.Lon[1]/60,
+		}
+		if d := distance(at, position); d <= amedasMaxDistance {
+			candidates = append(candidates, candidate{id, d})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+	ids := make([]string, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.id
+	}
+	return ids
+}
+
+// distance は2地点間のおおよその距離(km)を返す
+func distance(a, b Coordinates) float64 {
+	const earthRadius = 6371
+	rad := math.Pi / 180
+	x := (b.Longitude - a.Longitude) * rad * math.Cos((a.Latitude+b.Latitude)/2*rad)
+	y := (b.Latitude - a.Latitude) * rad
+	return math.Sqrt(x*x+y*y) * earthRadius
+}
+
+// dateKey は t の日本時間での日付を返す
+func dateKey(t time.Time) string {
+	return t.In(jst).Format("2006-01-02")
+}
+
+// field は values の i 番目を返す。ないときは空文字列を返す
+func field(values []string, i int) string {
+	if i < len(values) {
+		return values[i]
+	}
+	return ""
+}
+
+// number は values の i 番目を数値に変換する。ないときは Unknown を返す
+func number(values []string, i int) float64 {
+	n, err := strconv.ParseFloat(field(values, i), 64)
+	if err != nil {
+		return Unknown
+	}
+	return n
+}
+
+// valid はアメダスの観測値が正常な値かどうかを返す
+func valid(value []float64) bool {
+	return len(value) > 0 && (len(value) < 2 || value[1] == 0)
+}
+
+// 天気コードの説明
+// 3日間の予報には説明がついているが、1週間の予報は天気コードしかないので使う
+var jmaDescriptions = map[string]string{
+	"100": "晴れ", "101": "晴れ 時々 くもり", "102": "晴れ 一時 雨", "103": "晴れ 時々 雨",
+	"104": "晴れ 一時 雪", "105": "晴れ 時々 雪", "110": "晴れ 後 時々 くもり", "111": "晴れ 後 くもり",
+	"112": "晴れ 後 一時 雨", "113": "晴れ 後 時々 雨", "114": "晴れ 後 雨", "115": "晴れ 後 一時 雪",
+	"116": "晴れ 後 時々 雪", "117": "晴れ 後 雪",
+	"200": "くもり", "201": "くもり 時々 晴れ", "202": "くもり 一時 雨", "203": "くもり 時々 雨",
+	"204": "くもり 一時 雪", "205": "くもり 時々 雪", "210": "くもり 後 時々 晴れ", "211": "くもり 後 晴れ",
+	"212": "くもり 後 一時 雨", "213": "くもり 後 時々 雨", "214": "くもり 後 雨", "215": "くもり 後 一時 雪",
+	"216": "くもり 後 時々 雪", "217": "くもり 後 雪",
+	"300": "雨", "301": "雨 時々 晴れ", "302": "雨 時々 止む", "303": "雨 時々 雪",
+	"308": "暴風雨", "311": "雨 後 晴れ", "313": "雨 後 くもり", "314": "雨 後 時々 雪", "315": "雨 後 雪",
+	"400": "雪", "401": "雪 時々 晴れ", "402": "雪 時々 止む", "403": "雪 時々 雨",
+	"406": "風雪強い", "407": "暴風雪", "411": "雪 後 晴れ", "413": "雪 後 くもり", "414": "雪 後 雨",
+}
+
+// jmaDescription は天気コードの説明を返す
+// 一覧にないコードは百の位(1: 晴れ, 2: くもり, 3: 雨, 4: 雪)で判断する
+func jmaDescription(code string) string {
+	if text, ok := jmaDescriptions[code]; ok {
+		return text
+	}
+	switch code[0] {
+	case '1':
+		return "晴れ"
+	case '2':
+		return "くもり"
+	case '3':
+		return "雨"
+	case '4':
+		return "雪"
+	}
+	return ""
+}
+
+// jmaIcon は天気コードに近いOpenWeatherMapのアイコンの名前を返す
+func jmaIcon(code string) string {
+	switch {
+	case code == "100":
+		return "01d"
+	case code[0] == '1':
+		return "02d"
+	case code[0] == '2':
+		return "04d"
+	case code == "308":
+		return "11d"
+	case code[0] == '3':
+		return "10d"
+	case code[0] == '4':
+		return "13d"
+	}
+	return ""
+}
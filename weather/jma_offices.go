@@ -0,0 +1,73 @@
+package weather
+
+// jmaOffice は気象庁の天気予報を発表する地方の区分
+// 緯度経度はその地方の予報の代表となる地点(おもに気象台のある都市)
+type jmaOffice struct {
+	code      string
+	name      string
+	latitude  float64
+	longitude float64
+}
+
+// 気象庁の天気予報の地方の一覧
+// https://www.jma.go.jp/bosai/common/const/area.json の offices から抜き出した
+var jmaOffices = []jmaOffice{
+	{"011000", "宗谷地方", 45.415, 141.679},
+	{"012000", "上川・留萌地方", 43.757, 142.372},
+	{"013000", "網走・北見・紋別地方", 44.017, 144.280},
+	{"014030", "十勝地方", 42.922, 143.212},
+	{"014100", "釧路・根室地方", 42.985, 144.377},
+	{"015000", "胆振・日高地方", 42.315, 140.974},
+	{"016000", "石狩・空知・後志地方", 43.062, 141.329},
+	{"017000", "渡島・檜山地方", 41.817, 140.753},
+	{"020000", "青森県", 40.822, 140.769},
+	{"030000", "岩手県", 39.698, 141.166},
+	{"040000", "宮城県", 38.262, 140.897},
+	{"050000", "秋田県", 39.717, 140.098},
+	{"060000", "山形県", 38.255, 140.345},
+	{"070000", "福島県", 37.759, 140.470},
+	{"080000", "茨城県", 36.381, 140.467},
+	{"090000", "栃木県", 36.549, 139.868},
+	{"100000", "群馬県", 36.405, 139.060},
+	{"110000", "埼玉県", 36.150, 139.380},
+	{"120000", "千葉県", 35.738, 140.857},
+	{"130000", "東京都", 35.692, 139.750},
+	{"140000", "神奈川県", 35.439, 139.652},
+	{"150000", "新潟県", 37.893, 139.019},
+	{"160000", "富山県", 36.709, 137.202},
+	{"170000", "石川県", 36.588, 136.633},
+	{"180000", "福井県", 36.055, 136.222},
+	{"190000", "山梨県", 35.667, 138.555},
+	{"200000", "長野県", 36.662, 138.193},
+	{"210000", "岐阜県", 35.400, 136.762},
+	{"220000", "静岡県", 34.975, 138.404},
+	{"230000", "愛知県", 35.167, 136.965},
+	{"240000", "三重県", 34.733, 136.520},
+	{"250000", "滋賀県", 35.275, 136.243},
+	{"260000", "京都府", 35.015, 135.732},
+	{"270000", "大阪府", 34.682, 135.518},
+	{"280000", "兵庫県", 34.697, 135.212},
+	{"290000", "奈良県", 34.693, 135.827},
+	{"300000", "和歌山県", 34.228, 135.163},
+	{"310000", "鳥取県", 35.487, 134.238},
+	{"320000", "島根県", 35.457, 133.065},
+	{"330000", "岡山県", 34.658, 133.917},
+	{"340000", "広島県", 34.398, 132.462},
+	{"350000", "山口県", 33.948, 130.925},
+	{"360000", "徳島県", 34.067, 134.573},
+	{"370000", "香川県", 34.318, 134.053},
+	{"380000", "愛媛県", 33.843, 132.777},
+	{"390000", "高知県", 33.567, 133.548},
+	{"400000", "福岡県", 33.582, 130.375},
+	{"410000", "佐賀県", 33.265, 130.305},
+	{"420000", "長崎県", 32.733, 129.867},
+	{"430000", "熊本県", 32.813, 130.707},
+	{"440000", "大分県", 33.235, 131.618},
+	{"450000", "宮崎県", 31.938, 131.413},
+	{"460040", "奄美地方", 28.378, 129.495},
+	{"460100", "鹿児島県(奄美地方除く)", 31.555, 130.548},
+	{"471000", "沖縄本島地方", 26.207, 127.687},
+	{"472000", "大東島地方", 25.828, 131.228},
+	{"473000", "宮古島地方", 24.790, 125.278},
+	{"474000", "八重山地方", 24.337, 124.163},
+}
@@ -0,0 +1,300 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// OpenWeatherMap はOpenWeatherMapAPIを使う Provider
+type OpenWeatherMap struct {
+	appID string
+	*options
+}
+
+// NewOpenWeatherMap はAPIキー appID を使う OpenWeatherMap をつくる
+func NewOpenWeatherMap(appID string, opts ...Option) *OpenWeatherMap {
+	return &OpenWeatherMap{
+		appID:   appID,
+		options: newOptions("https://api.openweathermap.org", opts),
+	}
+}
+
+// 天気の情報で帰ってくる形式 (1)
+type owmWeather struct {
+	Main        string `json:"main"`        // 天気の種類 (Clouds など、英語だけ)
+	Description string `json:"description"` // 天気の説明 (lang で指定した言語)
+	Icon        string `json:"icon"`
+}
+
+// description は天気の説明を返す。説明がなければ天気の種類を返す
+func (w owmWeather) description() string {
+	if w.Description != "" {
+		return w.Description
+	}
+	return w.Main
+}
+
+// 天気の情報で帰ってくる形式 (2)
+type owmMain struct {
+	Temp     float64 `json:"temp"`     // 気温(℃)
+	Humidity float64 `json:"humidity"` // 湿度(%)
+}
+
+// 天気の情報で帰ってくる形式 (3)
+type owmWind struct {
+	Speed float64 `json:"speed"` // 風速(m/s)
+}
+
+// 現在の天気で帰ってくる形式
+type owmCurrent struct {
+	Dt       int64        `json:"dt"`
+	Weather  []owmWeather `json:"weather"`
+	Main     owmMain      `json:"main"`
+	Wind     owmWind      `json:"wind"`
+	Timezone int          `json:"timezone"` // UTCからのずれ(秒)
+}
+
+// 5日間(3時間ごと)の天気予報で帰ってくる形式 (1)
+type owmForecast struct {
+	List []owmForecastData `json:"list"`
+	City struct {
+		Timezone int `json:"timezone"` // UTCからのずれ(秒)
+	} `json:"city"`
+}
+
+// 5日間(3時間ごと)の天気予報で帰ってくる形式 (2)
+type owmForecastData struct {
+	Dt      int64        `json:"dt"`
+	Main    owmMain      `json:"main"`
+	Weather []owmWeather `json:"weather"`
+	Wind    owmWind      `json:"wind"`
+	Pop     float64      `json:"pop"` // 降水確率(0〜1)
+}
+
+// Current は現在の天気を返す
+func (p *OpenWeatherMap) Current(ctx context.Context, at Coordinates) (*Conditions, error) {
+	var data owmCurrent
+	if err := p.get(ctx, "/data/2.5/weather", at, &data); err != nil {
+		return nil, err
+	}
+	if len(data.Weather) == 0 {
+		return nil, invalidResponse(OpenWeatherMapProvider, "current conditions have no weather")
+	}
+	location := time.FixedZone("", data.Timezone)
+	return &Conditions{
+		Time:        time.Unix(data.Dt, 0).In(location),
+		Description: data.Weather[0].description(),
+		Icon:        data.Weather[0].Icon,
+		Temperature: Celsius(data.Main.Temp),
+		Humidity:    Percent(data.Main.Humidity),
+		// 現在の天気には降水確率が含まれない
+		PrecipitationProbability: Percent(Unknown),
+		WindSpeed:                MetersPerSecond(data.Wind.Speed),
+	}, nil
+}
+
+// Hourly は3時間ごと5日分の天気予報を返す
+func (p *OpenWeatherMap) Hourly(ctx context.Context, at Coordinates) (*HourlyForecast, error) {
+	data, err := p.forecast(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	location := time.FixedZone("", data.City.Timezone)
+	forecast := &HourlyForecast{
+		Location: location,
+		Interval: 3 * time.Hour,
+		Hours:    make([]Conditions, 0, len(data.List)),
+	}
+	for _, item := range data.List {
+		conditions := Conditions{
+			Time:                     time.Unix(item.Dt, 0).In(location),
+			Temperature:              Celsius(item.Main.Temp),
+			Humidity:                 Percent(item.Main.Humidity),
+			PrecipitationProbability: Percent(item.Pop * 100),
+			WindSpeed:                MetersPerSecond(item.Wind.Speed),
+		}
+		if len(item.Weather) > 0 {
+			conditions.Description = item.Weather[0].description()
+			conditions.Icon = item.Weather[0].Icon
+		}
+		forecast.Hours = append(forecast.Hours, conditions)
+	}
+	return forecast, nil
+}
+
+// Daily は3時間ごとの天気予報を、予報した場所のタイムゾーンでの日付ごとにまとめて返す
+// 今日の予報は残りの時間の分だけになる。最後の日が途中までしかないときは、その日を含めない
+func (p *OpenWeatherMap) Daily(ctx context.Context, at Coordinates) (*DailyForecast, error) {
+	hourly, err := p.Hourly(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	return p.DailyFromHourly(hourly), nil
+}
+
+// DailyFromHourly は Hourly の結果を Daily と同じように日付ごとにまとめる
+// Daily は Hourly と同じ /forecast を問い合わせるので、Cache はこれで Hourly の結果を使い回す
+func (p *OpenWeatherMap) DailyFromHourly(hourly *HourlyForecast) *DailyForecast {
+	forecast := &DailyForecast{Location: hourly.Location}
+	for start := 0; start < len(hourly.Hours); {
+		date := startOfDay(hourly.Hours[start].Time)
+		end := start
+		for end < len(hourly.Hours) && startOfDay(hourly.Hours[end].Time).Equal(date) {
+			end++
+		}
+		day := summarize(date, hourly.Hours[start:end])
+		last := hourly.Hours[end-1].Time
+		day.Partial = hourly.Hours[start].Time.After(date) || last.Add(hourly.Interval).Before(date.AddDate(0, 0, 1))
+		if day.Partial {
+			day.From, day.Until = hourly.Hours[start].Time, last.Add(hourly.Interval)
+		}
+		if end == len(hourly.Hours) && day.Partial && len(forecast.Days) > 0 {
+			break
+		}
+		forecast.Days = append(forecast.Days, day)
+		start = end
+	}
+	return forecast
+}
+
+// startOfDay は t と同じタイムゾーンでの t の日付の0時を返す
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// summarize は date の日の数時間ごとの予報を1日分の予報にまとめる
+// 天気とアイコンはその日の正午に一番近い予報のものを使う
+func summarize(date time.Time, hours []Conditions) Day {
+	noon := date.Add(12 * time.Hour)
+	representative := hours[0]
+	for _, h := range hours {
+		if absDuration(h.Time.Sub(noon)) < absDuration(representative.Time.Sub(noon)) {
+			representative = h
+		}
+	}
+	day := Day{
+		Date:                     date,
+		Description:              representative.Description,
+		Icon:                     representative.Icon,
+		TemperatureMin:           hours[0].Temperature,
+		TemperatureMax:           hours[0].Temperature,
+		PrecipitationProbability: hours[0].PrecipitationProbability,
+		WindSpeed:                hours[0].WindSpeed,
+	}
+	for _, h := range hours {
+		if h.Temperature < day.TemperatureMin {
+			day.TemperatureMin = h.Temperature
+		}
+		if h.Temperature > day.TemperatureMax {
+			day.TemperatureMax = h.Temperature
+		}
+		if h.PrecipitationProbability > day.PrecipitationProbability {
+			day.PrecipitationProbability = h.PrecipitationProbability
+		}
+		if h.WindSpeed > day.WindSpeed {
+			day.WindSpeed = h.WindSpeed
+		}
+		day.Humidity += h.Humidity / Percent(len(hours))
+	}
+	return day
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func (p *OpenWeatherMap) forecast(ctx context.Context, at Coordinates) (*owmForecast, error) {
+	var data owmForecast
+	if err := p.get(ctx, "/data/2.5/forecast", at, &data); err != nil {
+		return nil, err
+	}
+	if len(data.List) == 0 {
+		return nil, invalidResponse(OpenWeatherMapProvider, "forecast has no entries")
+	}
+	return &data, nil
+}
+
+// Geocode はOpenWeatherMapAPIの Geocoding API で地名から場所を調べる
+// 日本語の名前があるときはそれを使う
+func (p *OpenWeatherMap) Geocode(ctx context.Context, query string) ([]Place, error) {
+	q := url.Values{}
+	q.Set("q", query)
+	q.Set("limit", "5")
+	var data []struct {
+		Name       string            `json:"name"`
+		LocalNames map[string]string `json:"local_names"`
+		Lat        float64           `json:"lat"`
+		Lon        float64           `json:"lon"`
+		Country    string            `json:"country"`
+		State      string            `json:"state"`
+	}
+	if err := p.request(ctx, "/geo/1.0/direct", q, &data); err != nil {
+		return nil, err
+	}
+	places := make([]Place, 0, len(data))
+	for _, d := range data {
+		place := Place{
+			Name:        d.Name,
+			Region:      d.State,
+			Coordinates: Coordinates{Latitude: d.Lat, Longitude: d.Lon},
+		}
+		if name, ok := d.LocalNames["ja"]; ok {
+			place.Name = name
+		}
+		if place.Region == "" {
+			place.Region = d.Country
+		}
+		places = append(places, place)
+	}
+	return places, nil
+}
+
+// get はOpenWeatherMapAPIの path に at の緯度経度を付けてリクエストし、レスポンスを v に変換する
+func (p *OpenWeatherMap) get(ctx context.Context, path string, at Coordinates, v interface{}) error {
+	query := url.Values{}
+	query.Set("lat", strconv.FormatFloat(at.Latitude, 'f', 6, 64))
+	query.Set("lon", strconv.FormatFloat(at.Longitude, 'f', 6, 64))
+	// 気温は摂氏で、天気の説明は設定した言語で返してもらう
+	query.Set("units", "metric")
+	query.Set("lang", p.language)
+	return p.request(ctx, path, query, v)
+}
+
+// request はOpenWeatherMapAPIの path に query とAPIキーを付けてリクエストし、レスポンスを v に変換する
+func (p *OpenWeatherMap) request(ctx context.Context, path string, query url.Values, v interface{}) error {
+	query.Set("appid", p.appID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	// OpenWeatherMapAPIへのリクエスト
+	res, err := p.httpClient.Do(req)
+	if err != nil {
+		return requestError(OpenWeatherMapProvider, err)
+	}
+	defer res.Body.Close()
+
+	// エラーのときは {"cod": 401, "message": "Invalid API key. ..."} の形で理由が返ってくる
+	if res.StatusCode != http.StatusOK {
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(res.Body, 4096)).Decode(&body)
+		return statusError(OpenWeatherMapProvider, res.StatusCode, body.Message)
+	}
+
+	// OpenWeatherMapAPIからのレスポンスを扱いやすい形に変換する
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return invalidResponse(OpenWeatherMapProvider, "failed to decode %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+)
+
+// 地名で天気を調べるコマンドの最初の単語
+var placeCommands = []string{"天気", "weather"}
+
+// 何日後からの天気予報を答えるかを表す言葉
+var dayWords = map[string]int{
+	"今日": 0, "きょう": 0, "today": 0,
+	"明日": 1, "あした": 1, "tomorrow": 1,
+	"明後日": 2, "あさって": 2,
+}
+
+// クイックリプライのボタンの数とラベルの文字数の上限
+const (
+	maxQuickReplies    = 13
+	maxQuickReplyLabel = 20
+)
+
+const placeCommandUsage = "「天気 東京」や「weather Sapporo tomorrow」のように、天気の後に地名を送ってね！\n後ろに「明日」「明後日」を付けるとその日からの天気予報を、「5日」を付けると5日分を、「3時間ごと」を付けるとこれから24時間の天気予報を答えるよ"
+
+// placeCommand は「天気 東京 明日 5日」のようなコマンドを分解したもの
+type placeCommand struct {
+	// command は最初の単語 (天気, weather)
+	command string
+	// query は地名
+	query string
+	// viewWords は最後に付いていた見せ方を表す言葉 (明日, 5日, 3時間ごと など)
+	viewWords []string
+	// view は天気予報の見せ方
+	view View
+}
+
+// parsePlaceCommand は text を地名で天気を調べるコマンドとして分解する
+// 見せ方を表す言葉は地名の後ろにいくつでも、どの順番でも付けられる
+// コマンドでないときは ok が false になる
+func parsePlaceCommand(text string) (cmd placeCommand, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return placeCommand{}, false
+	}
+	for _, command := range placeCommands {
+		if strings.EqualFold(fields[0], command) {
+			cmd.command, ok = fields[0], true
+		}
+	}
+	if !ok {
+		return placeCommand{}, false
+	}
+	cmd.view = DefaultView
+	rest := fields[1:]
+	for len(rest) > 0 && parseViewWord(&cmd.view, rest[len(rest)-1]) {
+		cmd.viewWords = append([]string{rest[len(rest)-1]}, cmd.viewWords...)
+		rest = rest[:len(rest)-1]
+	}
+	cmd.query = strings.Join(rest, " ")
+	return cmd, true
+}
+
+// IsPlaceCommand は「天気 東京」のような、地名で天気を調べるコマンドかどうかを判定する
+// bot.Router の Matcher としてそのまま使える
+func IsPlaceCommand(event *linebot.Event) bool {
+	message, ok := event.Message.(*linebot.TextMessage)
+	if !ok {
+		return false
+	}
+	_, ok = parsePlaceCommand(message.Text)
+	return ok
+}
+
+// PlaceHandler は「天気 東京」「weather Sapporo tomorrow」のように送られてきた地名の天気予報を返信する
+// 返信にはクイックリプライを付け、3時間ごとの予報や日数の違う予報に切り替えられるようにする
+// 「天気 登録 東京 07:00」「天気 一覧」「天気 解除 3」は毎日送る天気予報の登録を操作する
+// 地名に当てはまる場所がいくつもあるときは、クイックリプライで場所を選んでもらう
+func (c *Client) PlaceHandler(ctx context.Context, event *linebot.Event) linebot.SendingMessage {
+	message, ok := event.Message.(*linebot.TextMessage)
+	if !ok {
+		return nil
+	}
+	cmd, ok := parsePlaceCommand(message.Text)
+	if !ok {
+		return linebot.NewTextMessage(placeCommandUsage)
+	}
+	if args, ok := unitsCommand(message.Text); ok {
+		return c.setUnits(ctx, bot.SourceID(event.Source), args)
+	}
+	if action, args, ok := subscriptionCommand(message.Text); ok {
+		return c.subscriptionHandler(ctx, event, cmd.command, action, args)
+	}
+	if cmd.query == "" {
+		return linebot.NewTextMessage(placeCommandUsage)
+	}
+
+	places, err := c.geocoder.Geocode(ctx, cmd.query)
+	if err != nil {
+		return errorReply(err)
+	}
+	switch len(places) {
+	case 0:
+		return linebot.NewTextMessage(fmt.Sprintf("「%s」という場所が見つからなかったよ...\n都道府県や市の名前で送ってみてね！", cmd.query))
+	case 1:
+		place := places[0]
+		replyMessage, err := c.forecastMessage(ctx, place.Coordinates, cmd.view, c.unitsFor(ctx, bot.SourceID(event.Source)))
+		if err != nil {
+			return errorReply(err)
+		}
+		replyMessage.AltText = place.FullName() + "の天気予報"
+		return replyMessage.WithQuickReplies(viewQuickReplies(place.FullName(), place.Coordinates, &cmd.view))
+	default:
+		return disambiguation(cmd.query, places, func(place Place) string {
+			text := cmd.command + " " + place.FullName()
+			if len(cmd.viewWords) > 0 {
+				text += " " + strings.Join(cmd.viewWords, " ")
+			}
+			return text
+		})
+	}
+}
+
+// disambiguation は当てはまった場所の中から1つを選んでもらう返信をつくる
+// ボタンを押すと、command で作ったコマンドが送られる
+// command では都道府県まで含めた地名を使って、もう一度同じ場所が見つからないようにする
+func disambiguation(query string, places []Place, command func(Place) string) linebot.SendingMessage {
+	if len(places) > maxQuickReplies {
+		places = places[:maxQuickReplies]
+	}
+	buttons := make([]*linebot.QuickReplyButton, 0, len(places))
+	for _, place := range places {
+		buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewMessageAction(truncate(place.FullName(), maxQuickReplyLabel), command(place))))
+	}
+	return linebot.NewTextMessage(fmt.Sprintf("「%s」はいくつか見つかったよ。どこの天気を調べる？", query)).
+		WithQuickReplies(linebot.NewQuickReplyItems(buttons...))
+}
+
+// truncate は s を最大 n 文字に切り詰める
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
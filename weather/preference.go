@@ -0,0 +1,140 @@
+package weather
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// PreferenceStore はユーザー (グループ・トークルーム) ごとの表示の設定を保存する
+// 天気予報の登録と同じく送信元 (bot.SourceID) ごとなので、グループでは全員に同じ設定を使う
+type PreferenceStore interface {
+	// Units は sourceID の単位系を返す。設定していないときは Metric を返す
+	Units(ctx context.Context, sourceID string) (Units, error)
+	// SetUnits は sourceID の単位系を保存する
+	SetUnits(ctx context.Context, sourceID string, units Units) error
+	// Forget は sourceID の設定をすべて削除する
+	Forget(ctx context.Context, sourceID string) error
+}
+
+// MemoryPreferenceStore はメモリに設定を保存する PreferenceStore
+// サーバを再起動すると設定は消える
+type MemoryPreferenceStore struct {
+	mu    sync.Mutex
+	units map[string]Units
+}
+
+// NewMemoryPreferenceStore は MemoryPreferenceStore を作る
+func NewMemoryPreferenceStore() *MemoryPreferenceStore {
+	return &MemoryPreferenceStore{units: map[string]Units{}}
+}
+
+// Units は sourceID の単位系を返す
+func (s *MemoryPreferenceStore) Units(ctx context.Context, sourceID string) (Units, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if units, ok := s.units[sourceID]; ok {
+		return units, nil
+	}
+	return Metric, nil
+}
+
+// SetUnits は sourceID の単位系を保存する
+func (s *MemoryPreferenceStore) SetUnits(ctx context.Context, sourceID string, units Units) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.units[sourceID] = units
+	return nil
+}
+
+// Forget は sourceID の設定を削除する
+func (s *MemoryPreferenceStore) Forget(ctx context.Context, sourceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.units, sourceID)
+	return nil
+}
+
+// MySQLPreferenceStore はMySQLデータベースに設定を保存する PreferenceStore
+type MySQLPreferenceStore struct {
+	db *sqlx.DB
+}
+
+// 表示の設定を保存するテーブル
+const createWeatherPreferencesTable = `CREATE TABLE IF NOT EXISTS weather_preferences (
+	source_id VARCHAR(64) NOT NULL PRIMARY KEY,
+	units VARCHAR(16) NOT NULL
+)`
+
+// NewMySQLPreferenceStore は MySQLPreferenceStore を作る
+// 保存用のテーブルがなければ作成する
+func NewMySQLPreferenceStore(ctx context.Context, db *sqlx.DB) (*MySQLPreferenceStore, error) {
+	if _, err := db.ExecContext(ctx, createWeatherPreferencesTable); err != nil {
+		return nil, err
+	}
+	return &MySQLPreferenceStore{db: db}, nil
+}
+
+// Units は sourceID の単位系を返す
+func (s *MySQLPreferenceStore) Units(ctx context.Context, sourceID string) (Units, error) {
+	var units Units
+	err := s.db.GetContext(ctx, &units, "SELECT units FROM weather_preferences WHERE source_id = ?", sourceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Metric, nil
+	}
+	if err != nil {
+		return Metric, err
+	}
+	return units, nil
+}
+
+// SetUnits は sourceID の単位系を保存する
+func (s *MySQLPreferenceStore) SetUnits(ctx context.Context, sourceID string, units Units) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO weather_preferences (source_id, units) VALUES (?, ?) ON DUPLICATE KEY UPDATE units = VALUES(units)", sourceID, units)
+	return err
+}
+
+// Forget は sourceID の設定を削除する
+func (s *MySQLPreferenceStore) Forget(ctx context.Context, sourceID string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM weather_preferences WHERE source_id = ?", sourceID)
+	return err
+}
+
+// 単位系を設定するコマンドの2番目の単語
+var unitsCommands = []string{"単位", "units"}
+
+const unitsUsage = "「天気 単位 華氏」や「天気 単位 摂氏」のように送ると、気温と風速の単位を変えられるよ！\nグループやトークルームでは、そこにいるみんなへの返信の単位が変わるよ"
+
+// unitsCommand は「天気 単位 華氏」の「単位」以降を返す
+// 単位系を設定するコマンドでないときは ok が false になる
+func unitsCommand(text string) (args []string, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) < 2 || !isWord(fields[1], unitsCommands) {
+		return nil, false
+	}
+	return fields[2:], true
+}
+
+// setUnits は sourceID の単位系を設定して返信する
+// 単位系が付いていないときは今の単位系を返信する
+// グループやトークルームでは、送った人だけでなくそのトークへの返信すべての単位系が変わる
+func (c *Client) setUnits(ctx context.Context, sourceID string, args []string) linebot.SendingMessage {
+	if len(args) == 0 {
+		return linebot.NewTextMessage("いまの単位は " + c.unitsFor(ctx, sourceID).Label() + " だよ\n" + unitsUsage)
+	}
+	units, ok := ParseUnits(args[0])
+	if len(args) != 1 || !ok {
+		return linebot.NewTextMessage(unitsUsage)
+	}
+	if err := c.preferences.SetUnits(ctx, sourceID, units); err != nil {
+		log.Printf("db error: %v", err)
+		return linebot.NewTextMessage("Botサーバーでエラーが発生しました")
+	}
+	return linebot.NewTextMessage("これからはこのトークでは " + units.Label() + " で天気を答えるよ！")
+}
@@ -0,0 +1,176 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Provider は天気の情報を提供するサービス
+// どのサービスを使っても同じ形・同じ単位で結果を返す
+type Provider interface {
+	// Current は at の現在の天気を返す
+	Current(ctx context.Context, at Coordinates) (*Conditions, error)
+	// Hourly は at の数時間ごとの天気予報を返す
+	Hourly(ctx context.Context, at Coordinates) (*HourlyForecast, error)
+	// Daily は at の1日ごとの天気予報を返す
+	Daily(ctx context.Context, at Coordinates) (*DailyForecast, error)
+}
+
+// Provider の名前の一覧
+const (
+	// OpenWeatherMapProvider はOpenWeatherMapAPIを使う。APIキーが必要
+	OpenWeatherMapProvider = "openweathermap"
+	// JMAProvider は気象庁のJSONを使う。日本国内だけに対応している
+	JMAProvider = "jma"
+)
+
+// NewProvider は name のサービスを使う Provider をつくる
+// appID はOpenWeatherMapAPIのAPIキーで、ほかのサービスでは使わない
+func NewProvider(name, appID string, opts ...Option) (Provider, error) {
+	switch name {
+	case OpenWeatherMapProvider:
+		if appID == "" {
+			return nil, errors.New("weather: APP_ID is required for openweathermap")
+		}
+		return NewOpenWeatherMap(appID, opts...), nil
+	case JMAProvider:
+		return NewJMA(opts...), nil
+	default:
+		return nil, fmt.Errorf("weather: unknown provider %q", name)
+	}
+}
+
+// Option は Provider の設定を変える
+type Option func(*options)
+
+type options struct {
+	httpClient *http.Client
+	baseURL    string
+	language   string
+}
+
+func newOptions(baseURL string, opts []Option) *options {
+	o := &options{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		baseURL:    baseURL,
+		language:   "ja",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithHTTPClient はAPIを呼び出すときに使う http.Client を設定する
+// 初期値はタイムアウトが10秒の http.Client
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithLanguage は天気の説明 (Conditions.Description) の言語を設定する
+// 初期値は日本語 (ja)。気象庁は日本語だけなので設定しても変わらない
+func WithLanguage(language string) Option {
+	return func(o *options) {
+		o.language = language
+	}
+}
+
+// WithBaseURL はAPIの呼び出し先を設定する
+// テストで偽物のサーバにリクエストを送るときに使う
+func WithBaseURL(baseURL string) Option {
+	return func(o *options) {
+		o.baseURL = baseURL
+	}
+}
+
+// Coordinates は緯度経度
+type Coordinates struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Celsius は摂氏の温度(℃)
+type Celsius float64
+
+// Fahrenheit は華氏の温度(℉)に変換する
+func (c Celsius) Fahrenheit() float64 {
+	return float64(c)*9/5 + 32
+}
+
+// Percent は百分率(%)
+type Percent float64
+
+// MetersPerSecond は風速(m/s)
+type MetersPerSecond float64
+
+// MilesPerHour はマイル毎時(mph)に変換する
+func (s MetersPerSecond) MilesPerHour() float64 {
+	return float64(s) * 3600 / 1609.344
+}
+
+// Unknown はサービスが提供していない値
+// 温度や湿度などの項目はわからないときにこの値(NaN)になる
+var Unknown = math.NaN()
+
+// Known は v がサービスから提供された値かどうかを返す
+func Known[T ~float64](v T) bool {
+	return !math.IsNaN(float64(v))
+}
+
+// Conditions はある時刻の天気
+type Conditions struct {
+	Time time.Time
+	// Description は天気の説明
+	Description string
+	// Icon はOpenWeatherMapのアイコンの名前("01d" など)
+	// ほかのサービスでも近い天気のアイコンの名前にそろえる
+	Icon        string
+	Temperature Celsius
+	Humidity    Percent
+	// PrecipitationProbability は降水確率
+	PrecipitationProbability Percent
+	WindSpeed                MetersPerSecond
+}
+
+// HourlyForecast は数時間ごとの天気予報
+type HourlyForecast struct {
+	// Location は予報した場所のタイムゾーン
+	Location *time.Location
+	// Interval は予報の間隔
+	Interval time.Duration
+	Hours    []Conditions
+}
+
+// Day は1日分の天気予報
+type Day struct {
+	// Date は予報した場所のタイムゾーンでのその日の0時
+	Date time.Time
+	// Partial は予報がその日の一部の時間の分しかないとき true になる
+	// 今日の予報は、すでに過ぎた時間の分が含まれないことがある
+	Partial bool
+	// From, Until は Partial のとき、予報がある時間の始めと終わり
+	From, Until    time.Time
+	Description    string
+	Icon           string
+	TemperatureMin Celsius
+	TemperatureMax Celsius
+	// Humidity はその日の平均の湿度
+	Humidity Percent
+	// PrecipitationProbability はその日の最大の降水確率
+	PrecipitationProbability Percent
+	// WindSpeed はその日の最大の風速
+	WindSpeed MetersPerSecond
+}
+
+// DailyForecast は1日ごとの天気予報
+type DailyForecast struct {
+	// Location は予報した場所のタイムゾーン
+	Location *time.Location
+	Days     []Day
+}
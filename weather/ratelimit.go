@@ -0,0 +1,115 @@
+package weather
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimited は Provider への問い合わせの回数を制限する Provider
+//
+// トークンバケットで制限する。バケットには最大 burst 個のトークンが入り、
+// 1分あたり perMinute 個ずつ補充される。問い合わせごとにトークンを1つ使い、
+// トークンがないときは Provider を呼び出さずに ErrRateLimited を返す
+type RateLimited struct {
+	provider Provider
+	// 1秒あたりに補充するトークンの数
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimited は provider への問い合わせを1分あたり perMinute 回、一度に burst 回までに制限する
+// perMinute が0以下のときは制限しない
+func NewRateLimited(provider Provider, perMinute, burst int) *RateLimited {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimited{
+		provider: provider,
+		rate:     float64(perMinute) / 60,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// UpdateIntervals は制限している Provider の更新間隔を返す
+func (r *RateLimited) UpdateIntervals() Intervals {
+	if p, ok := r.provider.(interface{ UpdateIntervals() Intervals }); ok {
+		return p.UpdateIntervals()
+	}
+	return DefaultIntervals
+}
+
+// Unwrap は制限している Provider を返す
+func (r *RateLimited) Unwrap() Provider {
+	return r.provider
+}
+
+// allow はトークンを1つ使う。トークンがなければ false を返す
+func (r *RateLimited) allow() bool {
+	if r.rate <= 0 {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+	if r.tokens < 1 {
+		metrics.Add(rateLimited, 1)
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// Geocoder は geocoder への問い合わせも r と同じトークンを使って制限する Geocoder を返す
+// OpenWeatherMapAPIの上限は地名の検索も合わせた回数なので、天気の問い合わせと一緒に数える
+func (r *RateLimited) Geocoder(geocoder Geocoder) Geocoder {
+	return rateLimitedGeocoder{limiter: r, geocoder: geocoder}
+}
+
+type rateLimitedGeocoder struct {
+	limiter  *RateLimited
+	geocoder Geocoder
+}
+
+// Geocode はトークンがあれば地名を調べ、なければ ErrRateLimited を返す
+func (g rateLimitedGeocoder) Geocode(ctx context.Context, query string) ([]Place, error) {
+	if !g.limiter.allow() {
+		return nil, ErrRateLimited
+	}
+	return g.geocoder.Geocode(ctx, query)
+}
+
+// Current は現在の天気を返す
+func (r *RateLimited) Current(ctx context.Context, at Coordinates) (*Conditions, error) {
+	if !r.allow() {
+		return nil, ErrRateLimited
+	}
+	return r.provider.Current(ctx, at)
+}
+
+// Hourly は数時間ごとの天気予報を返す
+func (r *RateLimited) Hourly(ctx context.Context, at Coordinates) (*HourlyForecast, error) {
+	if !r.allow() {
+		return nil, ErrRateLimited
+	}
+	return r.provider.Hourly(ctx, at)
+}
+
+// Daily は1日ごとの天気予報を返す
+func (r *RateLimited) Daily(ctx context.Context, at Coordinates) (*DailyForecast, error) {
+	if !r.allow() {
+		return nil, ErrRateLimited
+	}
+	return r.provider.Daily(ctx, at)
+}
@@ -0,0 +1,79 @@
+package weather_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/weather"
+	"github.com/xxarupakaxx/sysad-linebot-handson/weather/weathertest"
+)
+
+func TestRateLimitedRunsOutOfTokens(t *testing.T) {
+	fake := weathertest.New()
+	provider := weather.NewRateLimited(fake, 1, 2)
+
+	for i := 0; i < 2; i++ {
+		if _, err := provider.Current(context.Background(), tokyo); err != nil {
+			t.Fatalf("lookup %d failed: %v", i+1, err)
+		}
+	}
+	if _, err := provider.Current(context.Background(), tokyo); !errors.Is(err, weather.ErrRateLimited) {
+		t.Errorf("got %v, want ErrRateLimited", err)
+	}
+	if calls := fake.Calls("Current"); calls != 2 {
+		t.Errorf("got %d upstream calls, want 2", calls)
+	}
+}
+
+func TestRateLimitedReply(t *testing.T) {
+	client := weather.New(weather.NewCache(weather.NewRateLimited(weathertest.New(), 1, 1)))
+	send := func(text string) linebot.SendingMessage {
+		return client.PlaceHandler(context.Background(), &linebot.Event{
+			Source:  &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "Uratelimit"},
+			Message: &linebot.TextMessage{Text: text},
+		})
+	}
+
+	if reply, ok := send("天気 東京").(*linebot.FlexMessage); !ok {
+		t.Fatalf("got %#v, want a forecast", reply)
+	}
+	// 違う場所なので覚えた結果は使えず、トークンが足りない
+	got, err := json.Marshal(send("天気 大阪"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(linebot.NewTextMessage(weather.ErrorMessage(weather.ErrRateLimited)))
+	if string(got) != string(want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// countingGeocoder は呼び出された回数を数える Geocoder
+type countingGeocoder struct {
+	calls int
+}
+
+func (g *countingGeocoder) Geocode(ctx context.Context, query string) ([]weather.Place, error) {
+	g.calls++
+	return []weather.Place{{Name: query, Coordinates: tokyo}}, nil
+}
+
+func TestRateLimitedGeocoderSharesTokens(t *testing.T) {
+	provider := weather.NewRateLimited(weathertest.New(), 1, 1)
+	geocoder := &countingGeocoder{}
+	limited := provider.Geocoder(geocoder)
+
+	if _, err := provider.Current(context.Background(), tokyo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := limited.Geocode(context.Background(), "Springfield"); !errors.Is(err, weather.ErrRateLimited) {
+		t.Errorf("got %v, want ErrRateLimited", err)
+	}
+	if geocoder.calls != 0 {
+		t.Errorf("got %d geocoder calls, want 0", geocoder.calls)
+	}
+}
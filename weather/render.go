@@ -0,0 +1,158 @@
+package weather
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Units は気温や風速を表す単位系
+type Units string
+
+const (
+	// Metric は摂氏 (℃) とメートル毎秒 (m/s)
+	Metric Units = "metric"
+	// Imperial は華氏 (℉) とマイル毎時 (mph)
+	Imperial Units = "imperial"
+)
+
+// 単位系を表す言葉
+var unitsWords = map[string]Units{
+	"摂氏": Metric, "℃": Metric, "メートル法": Metric, "metric": Metric, "c": Metric,
+	"華氏": Imperial, "℉": Imperial, "ヤード・ポンド法": Imperial, "imperial": Imperial, "f": Imperial,
+}
+
+// ParseUnits は「華氏」「imperial」のような言葉を単位系にする
+func ParseUnits(word string) (Units, bool) {
+	units, ok := unitsWords[strings.ToLower(word)]
+	return units, ok
+}
+
+// Label は単位系の名前 (例: 摂氏・m/s) を返す
+func (u Units) Label() string {
+	if u == Imperial {
+		return "華氏(℉)・mph"
+	}
+	return "摂氏(℃)・m/s"
+}
+
+// Temperature は気温を整数に丸めて単位を付ける (例: 12℃, 54℉)
+// わからないときは "--" にする
+func (u Units) Temperature(c Celsius) string {
+	if !Known(c) {
+		return "--"
+	}
+	if u == Imperial {
+		return formatRounded(float64(c.Fahrenheit()), 0) + "℉"
+	}
+	return formatRounded(float64(c), 0) + "℃"
+}
+
+// WindSpeed は風速を小数点以下1桁に丸めて単位を付ける (例: 3.6 m/s, 8.1 mph)
+// わからないときは "--" にする
+func (u Units) WindSpeed(v MetersPerSecond) string {
+	if !Known(v) {
+		return "--"
+	}
+	if u == Imperial {
+		return formatRounded(float64(v.MilesPerHour()), 1) + " mph"
+	}
+	return formatRounded(float64(v), 1) + " m/s"
+}
+
+// celsius は u の単位で送られた気温 (例: 華氏なら 32) を摂氏にする
+func (u Units) celsius(v float64) Celsius {
+	if u == Imperial {
+		return Celsius((v - 32) * 5 / 9)
+	}
+	return Celsius(v)
+}
+
+// metersPerSecond は u の単位で送られた風速 (例: mphなら 20) をメートル毎秒にする
+func (u Units) metersPerSecond(v float64) MetersPerSecond {
+	if u == Imperial {
+		return MetersPerSecond(v * 1609.344 / 3600)
+	}
+	return MetersPerSecond(v)
+}
+
+// thresholdTemperature は警報のしきい値の気温を u の単位で表す (例: 0℃, 32℉)
+// 丸めて表示する気温と違い、小数点以下1桁まで残す
+func (u Units) thresholdTemperature(c Celsius) string {
+	if u == Imperial {
+		return formatThreshold(c.Fahrenheit()) + "℉"
+	}
+	return formatThreshold(float64(c)) + "℃"
+}
+
+// thresholdWindSpeed は警報のしきい値の風速を u の単位で表す (例: 10 m/s, 22.4 mph)
+func (u Units) thresholdWindSpeed(v MetersPerSecond) string {
+	if u == Imperial {
+		return formatThreshold(v.MilesPerHour()) + " mph"
+	}
+	return formatThreshold(float64(v)) + " m/s"
+}
+
+// formatThreshold は v を小数点以下1桁に四捨五入し、余計な0を付けずに表す (例: 32, 22.4)
+// 単位を変換したときの誤差 (32.00000000000001 など) を見せないようにする
+func formatThreshold(v float64) string {
+	rounded := math.Round(v*10) / 10
+	if rounded == 0 {
+		rounded = 0
+	}
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+// formatPercent は湿度や降水確率を整数に丸めて表す (例: 48%)
+// わからないときは "--" にする
+func formatPercent(p Percent) string {
+	if !Known(p) {
+		return "--"
+	}
+	return formatRounded(float64(p), 0) + "%"
+}
+
+// formatRounded は v を小数点以下 digits 桁に四捨五入して表す
+// -0.3 を "-0" にしないように、丸めて0になったときは符号を付けない
+func formatRounded(v float64, digits int) string {
+	scale := math.Pow(10, float64(digits))
+	rounded := math.Round(v*scale) / scale
+	if rounded == 0 {
+		rounded = 0
+	}
+	return fmt.Sprintf("%.*f", digits, rounded)
+}
+
+// weatherEmoji はOpenWeatherMapのアイコンの名前 (例: 04d) の頭2文字ごとの絵文字
+var weatherEmoji = map[string]string{
+	"01": "☀️", // 快晴
+	"02": "🌤️", // 晴れ
+	"03": "⛅",  // 曇り
+	"04": "☁️", // 厚い雲
+	"09": "🌧️", // にわか雨
+	"10": "🌦️", // 雨
+	"11": "⛈️", // 雷雨
+	"13": "❄️", // 雪
+	"50": "🌫️", // 霧
+}
+
+// WeatherEmoji はOpenWeatherMapのアイコンの名前を、テキストの返信で使う絵文字にする
+// 夜の快晴 (01n) は月にする。わからないアイコンのときは空文字列を返す
+func WeatherEmoji(icon string) string {
+	if icon == "01n" {
+		return "🌙"
+	}
+	if len(icon) < 2 {
+		return ""
+	}
+	return weatherEmoji[icon[:2]]
+}
+
+// describeWeather は天気の説明の前に絵文字を付ける (例: ☁️ 曇りがち)
+func describeWeather(description, icon string) string {
+	if emoji := WeatherEmoji(icon); emoji != "" {
+		return emoji + " " + description
+	}
+	return description
+}
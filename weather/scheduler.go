@@ -0,0 +1,147 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+)
+
+// Scheduler は登録した時刻になったら天気予報をプッシュメッセージで送る
+type Scheduler struct {
+	client *Client
+	store  *SubscriptionStore
+	pusher bot.Pusher
+}
+
+// NewScheduler は store の登録に従って、client で作った天気予報を pusher で送る Scheduler を作る
+func NewScheduler(client *Client, store *SubscriptionStore, pusher bot.Pusher) *Scheduler {
+	return &Scheduler{client: client, store: store, pusher: pusher}
+}
+
+// 警報を出すかを確かめる間隔
+const alertCheckInterval = 10 * time.Minute
+
+// Job は1分ごとに送る時刻になった登録を確かめる bot.Job を返す
+// bot.Server.Go に渡して動かす
+func (s *Scheduler) Job() bot.Job {
+	return bot.Every(time.Minute, s.Tick)
+}
+
+// AlertJob は10分ごとに警報を出すかを確かめる bot.Job を返す
+// bot.Server.Go に渡して動かす
+func (s *Scheduler) AlertJob() bot.Job {
+	return bot.Every(alertCheckInterval, s.CheckAlerts)
+}
+
+// Tick は now に送る時刻になった登録に天気予報を送る
+// 1日に1回だけ送り、送れなかったときは次の呼び出しでもう一度送る
+func (s *Scheduler) Tick(ctx context.Context, now time.Time) {
+	subs, err := s.store.All(ctx)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return
+	}
+	for _, sub := range subs {
+		date, ok := due(sub, now)
+		if !ok {
+			continue
+		}
+		claimed, err := s.store.markSent(ctx, sub.ID, date)
+		if err != nil {
+			log.Printf("db error: %v", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if err := s.push(ctx, sub); err != nil {
+			log.Printf("failed to push weather subscription %d: %v", sub.ID, err)
+			if err := s.store.unmarkSent(ctx, sub.ID); err != nil {
+				log.Printf("db error: %v", err)
+			}
+		}
+	}
+}
+
+// push は sub の場所の天気予報を送る
+func (s *Scheduler) push(ctx context.Context, sub Subscription) error {
+	message, err := s.client.forecastMessage(ctx, sub.Coordinates, DefaultView, s.client.unitsFor(ctx, sub.SourceID))
+	if err != nil {
+		return err
+	}
+	message.AltText = sub.Place + "の天気予報"
+	_, err = s.pusher.PushMessage(sub.SourceID, message.WithQuickReplies(viewQuickReplies(sub.Place, sub.Coordinates, &DefaultView))).WithContext(ctx).Do()
+	return err
+}
+
+// due は now が sub の送る時刻から bot.LateWindow の間に入っているかを返す
+// 入っているときは、その場所のタイムゾーンでの今日の日付も返す
+func due(sub Subscription, now time.Time) (date string, ok bool) {
+	local := now.In(sub.Location())
+	minute := local.Hour()*60 + local.Minute()
+	end := sub.NotifyMinute + int(bot.LateWindow/time.Minute)
+	// 日付をまたいで送ると次の日の分と重なるので、その日のうちだけにする
+	if end > 24*60 {
+		end = 24 * 60
+	}
+	if minute < sub.NotifyMinute || minute >= end {
+		return "", false
+	}
+	return local.Format("2006-01-02"), true
+}
+
+// CheckAlerts は警報を設定した登録のうち、これから3時間の予報がしきい値を超えるものに警報を送る
+// 同じ種類の警報は続けて送らず、おやすみの時間の間は送らない
+func (s *Scheduler) CheckAlerts(ctx context.Context, now time.Time) {
+	if err := s.store.purgeAlertEvents(ctx, now.Add(-2*alertCooldown)); err != nil {
+		log.Printf("db error: %v", err)
+	}
+	alerts, err := s.store.Alerts(ctx)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return
+	}
+	for _, alert := range alerts {
+		// おやすみの時間が終わったときに、まだしきい値を超えそうならそのとき送る
+		if alert.quiet(now) {
+			continue
+		}
+		forecast, err := s.client.provider.Hourly(ctx, alert.Coordinates)
+		if err != nil {
+			log.Printf("failed to check weather alert %d: %v", alert.ID, err)
+			continue
+		}
+		var lines []string
+		var marked []alertEvent
+		for _, event := range alertEvents(alert, forecast, now) {
+			ok, err := s.store.markAlerted(ctx, alert.ID, event.kind, event.forecast.Time)
+			if err != nil {
+				log.Printf("db error: %v", err)
+				continue
+			}
+			if ok {
+				marked = append(marked, event)
+				lines = append(lines, alertLine(event, forecast.Location, s.client.unitsFor(ctx, alert.SourceID)))
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		text := fmt.Sprintf("⚠ %sの天気に気をつけてね！\n%s\n\n警報の設定は「天気 警報 %d」で確かめられるよ", alert.Place, strings.Join(lines, "\n"), alert.ID)
+		if _, err := s.pusher.PushMessage(alert.SourceID, linebot.NewTextMessage(text)).WithContext(ctx).Do(); err != nil {
+			log.Printf("failed to push weather alert %d: %v", alert.ID, err)
+			// 送れなかった警報は、次に確かめたときにもう一度送る
+			for _, event := range marked {
+				if err := s.store.unmarkAlerted(ctx, alert.ID, event.kind, event.forecast.Time); err != nil {
+					log.Printf("db error: %v", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+)
+
+// 天気予報の登録を操作するコマンドの2番目の単語
+var subscriptionCommands = map[string]string{
+	"登録": "subscribe", "subscribe": "subscribe",
+	"一覧": "list", "list": "list",
+	"解除": "cancel", "unsubscribe": "cancel",
+	"警報": "alert", "alert": "alert",
+}
+
+const subscriptionUsage = `毎日決まった時刻に天気予報を送るよ！
+	天気 登録 東京 07:00
+	天気 一覧
+	天気 解除 登録番号`
+
+const alertUsage = `登録した場所の天気が悪くなりそうなときに知らせるよ！
+	天気 警報 登録番号 雨 60 (これから3時間の降水確率が60%以上)
+	天気 警報 登録番号 気温 0 (0℃未満)
+	天気 警報 登録番号 風 10 (風速10m/s以上)
+	天気 警報 登録番号 おやすみ 22:00-07:00 (この時間は知らせない)
+	天気 警報 登録番号 雨 オフ / 天気 警報 登録番号 オフ
+値を省くと 雨 50%・気温 0℃・風 10m/s になるよ
+「天気 単位 華氏」にしているときは、気温は℉、風速はmphで送ってね`
+
+// 送る時刻の書き方 (例: 07:00, 7:00, 7時, 7時30分)
+var (
+	clockPattern = regexp.MustCompile(`^(\d{1,2})[:：](\d{2})$`)
+	hourPattern  = regexp.MustCompile(`^(\d{1,2})時(?:(\d{1,2})分)?$`)
+)
+
+// parseTimeOfDay は "07:00" や "7時30分" を0時からの分にする
+func parseTimeOfDay(s string) (int, bool) {
+	m := clockPattern.FindStringSubmatch(s)
+	if m == nil {
+		m = hourPattern.FindStringSubmatch(s)
+	}
+	if m == nil {
+		return 0, false
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute := 0
+	if m[2] != "" {
+		minute, _ = strconv.Atoi(m[2])
+	}
+	if hour > 23 || minute > 59 {
+		return 0, false
+	}
+	return hour*60 + minute, true
+}
+
+// WithSubscriptions は天気予報の登録を保存する SubscriptionStore を設定する
+// 設定しないときは「天気 登録」などのコマンドは使えない
+func WithSubscriptions(store *SubscriptionStore) ClientOption {
+	return func(c *Client) {
+		c.subscriptions = store
+	}
+}
+
+// subscriptionCommand は「天気 登録 東京 07:00」の「登録」以降を返す
+// 登録を操作するコマンドでないときは ok が false になる
+func subscriptionCommand(text string) (action string, args []string, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		return "", nil, false
+	}
+	action, ok = subscriptionCommands[strings.ToLower(fields[1])]
+	return action, fields[2:], ok
+}
+
+// subscriptionHandler は「天気 登録」「天気 一覧」「天気 解除」「天気 警報」に返信する
+func (c *Client) subscriptionHandler(ctx context.Context, event *linebot.Event, command, action string, args []string) linebot.SendingMessage {
+	if c.subscriptions == nil {
+		return linebot.NewTextMessage("ごめんね、このBotでは天気予報の登録は使えないよ...")
+	}
+	sourceID := bot.SourceID(event.Source)
+	switch action {
+	case "subscribe":
+		return c.subscribe(ctx, sourceID, command, args)
+	case "list":
+		return c.listSubscriptions(ctx, sourceID)
+	case "alert":
+		return c.configureAlert(ctx, sourceID, args)
+	default:
+		return c.unsubscribe(ctx, sourceID, args)
+	}
+}
+
+// subscribe は天気予報の登録を保存する
+func (c *Client) subscribe(ctx context.Context, sourceID, command string, args []string) linebot.SendingMessage {
+	if len(args) < 2 {
+		return linebot.NewTextMessage(subscriptionUsage)
+	}
+	clock := args[len(args)-1]
+	minute, ok := parseTimeOfDay(clock)
+	if !ok {
+		return linebot.NewTextMessage(fmt.Sprintf("「%s」は時刻として読めなかったよ...\n「07:00」のように送ってね！", clock))
+	}
+	query := strings.Join(args[:len(args)-1], " ")
+
+	places, err := c.geocoder.Geocode(ctx, query)
+	if err != nil {
+		return errorReply(err)
+	}
+	switch len(places) {
+	case 0:
+		return linebot.NewTextMessage(fmt.Sprintf("「%s」という場所が見つからなかったよ...\n都道府県や市の名前で送ってみてね！", query))
+	case 1:
+	default:
+		return disambiguation(query, places, func(place Place) string {
+			return strings.Join([]string{command, "登録", place.FullName(), clock}, " ")
+		})
+	}
+	place := places[0]
+
+	subs, err := c.subscriptions.List(ctx, sourceID)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return linebot.NewTextMessage("Botサーバーでエラーが発生しました")
+	}
+	if len(subs) >= MaxSubscriptions {
+		return linebot.NewTextMessage(fmt.Sprintf("登録できるのは%d件までだよ。「天気 解除 登録番号」でいらない登録を消してね", MaxSubscriptions))
+	}
+
+	// 送る時刻はその場所のタイムゾーンで数えるので、天気予報からタイムゾーンを調べる
+	// その場所の天気予報が調べられるかもここで確かめる
+	forecast, err := c.provider.Daily(ctx, place.Coordinates)
+	if err != nil {
+		return errorReply(err)
+	}
+	_, offset := time.Now().In(forecast.Location).Zone()
+
+	sub := Subscription{
+		SourceID:     sourceID,
+		Place:        place.FullName(),
+		Coordinates:  place.Coordinates,
+		NotifyMinute: minute,
+		UTCOffset:    offset,
+	}
+	id, err := c.subscriptions.Add(ctx, sub)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return linebot.NewTextMessage("Botサーバーでエラーが発生しました")
+	}
+	return linebot.NewTextMessage(fmt.Sprintf("毎日 %s に%sの天気予報を送るよ！(登録番号: %d)\n止めるときは「天気 解除 %d」と送ってね", sub.Time(), sub.Place, id, id))
+}
+
+// listSubscriptions は登録している天気予報の一覧を返信する
+func (c *Client) listSubscriptions(ctx context.Context, sourceID string) linebot.SendingMessage {
+	subs, err := c.subscriptions.List(ctx, sourceID)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return linebot.NewTextMessage("Botサーバーでエラーが発生しました")
+	}
+	if len(subs) == 0 {
+		return linebot.NewTextMessage("登録している天気予報はないよ\n「天気 登録 東京 07:00」のように送ると、毎日その時刻に天気予報を送るよ！")
+	}
+	text := "登録番号/場所/時刻"
+	for _, sub := range subs {
+		text += fmt.Sprintf("\n%d/%s/毎日 %s", sub.ID, sub.Place, sub.Time())
+	}
+	return linebot.NewTextMessage(text)
+}
+
+// unsubscribe は登録番号の天気予報の登録を削除する
+func (c *Client) unsubscribe(ctx context.Context, sourceID string, args []string) linebot.SendingMessage {
+	if len(args) != 1 {
+		return linebot.NewTextMessage(subscriptionUsage)
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return linebot.NewTextMessage(fmt.Sprintf("「%s」は登録番号として読めなかったよ...\n登録番号は「天気 一覧」で確かめてね", args[0]))
+	}
+	deleted, err := c.subscriptions.Delete(ctx, sourceID, id)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return linebot.NewTextMessage("Botサーバーでエラーが発生しました")
+	}
+	if !deleted {
+		return linebot.NewTextMessage(fmt.Sprintf("登録番号%dの天気予報は見つからなかったよ\n登録番号は「天気 一覧」で確かめてね", id))
+	}
+	return linebot.NewTextMessage(fmt.Sprintf("登録番号%dの天気予報を止めたよ", id))
+}
+
+// configureAlert は登録番号の警報の設定を変えて、変えた後の設定を返信する
+// 設定が付いていないときは今の設定を返信する
+func (c *Client) configureAlert(ctx context.Context, sourceID string, args []string) linebot.SendingMessage {
+	if len(args) == 0 {
+		return linebot.NewTextMessage(alertUsage)
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return linebot.NewTextMessage(fmt.Sprintf("「%s」は登録番号として読めなかったよ...\n登録番号は「天気 一覧」で確かめてね", args[0]))
+	}
+	alert, err := c.subscriptions.Alert(ctx, sourceID, id)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return linebot.NewTextMessage("Botサーバーでエラーが発生しました")
+	}
+	if alert == nil {
+		return linebot.NewTextMessage(fmt.Sprintf("登録番号%dの天気予報は見つからなかったよ\n登録番号は「天気 一覧」で確かめてね", id))
+	}
+	units := c.unitsFor(ctx, sourceID)
+	if len(args) == 1 {
+		return linebot.NewTextMessage(alert.describe(units))
+	}
+	if err := applyAlertArgs(alert, args[1:], units); err != nil {
+		return linebot.NewTextMessage(err.Error() + "\n\n" + alertUsage)
+	}
+	if err := c.subscriptions.SaveAlert(ctx, alert); err != nil {
+		log.Printf("db error: %v", err)
+		return linebot.NewTextMessage("Botサーバーでエラーが発生しました")
+	}
+	return linebot.NewTextMessage("警報の設定を変えたよ！\n" + alert.describe(units))
+}
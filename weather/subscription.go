@@ -0,0 +1,149 @@
+package weather
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MaxSubscriptions は1人 (1つのグループ) が登録できる天気予報の数
+const MaxSubscriptions = 5
+
+// Subscription は毎日決まった時刻に天気予報を送る登録
+type Subscription struct {
+	ID uint64 `db:"id"`
+	// SourceID は送り先のユーザー・グループ・トークルームのID
+	SourceID string `db:"source_id"`
+	// Place は登録した場所の名前 (例: 東京都府中市)
+	Place string `db:"place"`
+	Coordinates
+	// NotifyMinute は送る時刻を0時からの分で表したもの (7:00 なら 420)
+	NotifyMinute int `db:"notify_minute"`
+	// UTCOffset は送る時刻を数えるタイムゾーンの UTC からの差 (秒)
+	UTCOffset int `db:"utc_offset"`
+}
+
+// Time は送る時刻を "07:00" の形で返す
+func (s Subscription) Time() string {
+	return clock(s.NotifyMinute)
+}
+
+// Location は送る時刻を数えるタイムゾーンを返す
+func (s Subscription) Location() *time.Location {
+	return time.FixedZone("", s.UTCOffset)
+}
+
+// SubscriptionStore は天気予報の登録をMySQLデータベースに保存する
+type SubscriptionStore struct {
+	db *sqlx.DB
+}
+
+// 天気予報の登録を保存するテーブル
+// last_sent_on は最後に送った日 (登録した場所のタイムゾーンでの日付)
+const createWeatherSubscriptionsTable = `CREATE TABLE IF NOT EXISTS weather_subscriptions (
+	id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	source_id VARCHAR(64) NOT NULL,
+	place VARCHAR(255) NOT NULL,
+	latitude DOUBLE NOT NULL,
+	longitude DOUBLE NOT NULL,
+	notify_minute SMALLINT NOT NULL,
+	utc_offset INT NOT NULL,
+	last_sent_on DATE NULL,
+	created_at DATETIME NOT NULL,
+	INDEX (source_id)
+)`
+
+// NewSubscriptionStore は SubscriptionStore を作る
+// 保存用のテーブルがなければ作成する
+func NewSubscriptionStore(ctx context.Context, db *sqlx.DB) (*SubscriptionStore, error) {
+	for _, table := range []string{createWeatherSubscriptionsTable, createWeatherAlertsTable, createWeatherAlertEventsTable} {
+		if _, err := db.ExecContext(ctx, table); err != nil {
+			return nil, err
+		}
+	}
+	return &SubscriptionStore{db: db}, nil
+}
+
+const subscriptionColumns = "id, source_id, place, latitude, longitude, notify_minute, utc_offset"
+
+// Add は登録を保存し、登録番号を返す
+func (s *SubscriptionStore) Add(ctx context.Context, sub Subscription) (uint64, error) {
+	result, err := s.db.ExecContext(ctx,
+		"INSERT INTO weather_subscriptions (source_id, place, latitude, longitude, notify_minute, utc_offset, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		sub.SourceID, sub.Place, sub.Latitude, sub.Longitude, sub.NotifyMinute, sub.UTCOffset, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(id), nil
+}
+
+// List は sourceID の登録を送る時刻の順に返す
+func (s *SubscriptionStore) List(ctx context.Context, sourceID string) ([]Subscription, error) {
+	var subs []Subscription
+	err := s.db.SelectContext(ctx, &subs, "SELECT "+subscriptionColumns+" FROM weather_subscriptions WHERE source_id = ? ORDER BY notify_minute, id", sourceID)
+	return subs, err
+}
+
+// All はすべての登録を返す
+func (s *SubscriptionStore) All(ctx context.Context) ([]Subscription, error) {
+	var subs []Subscription
+	err := s.db.SelectContext(ctx, &subs, "SELECT "+subscriptionColumns+" FROM weather_subscriptions")
+	return subs, err
+}
+
+// Delete は sourceID の登録番号 id の登録を、警報の設定と一緒に削除する
+// 見つからなかったときは false を返す
+func (s *SubscriptionStore) Delete(ctx context.Context, sourceID string, id uint64) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM weather_subscriptions WHERE id = ? AND source_id = ?", id, sourceID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM weather_alerts WHERE subscription_id = ?", id); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// Forget は sourceID の登録を、警報の設定と送った警報の記録と一緒にすべて削除する
+func (s *SubscriptionStore) Forget(ctx context.Context, sourceID string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE weather_alert_events FROM weather_alert_events JOIN weather_subscriptions s ON s.id = weather_alert_events.subscription_id WHERE s.source_id = ?", sourceID); err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE weather_alerts FROM weather_alerts JOIN weather_subscriptions s ON s.id = weather_alerts.subscription_id WHERE s.source_id = ?", sourceID); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, "DELETE FROM weather_subscriptions WHERE source_id = ?", sourceID)
+	return err
+}
+
+// markSent は登録 id を date (2006-01-02) に送ったことにする
+// すでに date に送っていたときは false を返すので、複数台で動かしても二重に送らない
+func (s *SubscriptionStore) markSent(ctx context.Context, id uint64, date string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE weather_subscriptions SET last_sent_on = ? WHERE id = ? AND (last_sent_on IS NULL OR last_sent_on <> ?)", date, id, date)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// unmarkSent は送れなかった登録を、まだ送っていないことにする
+func (s *SubscriptionStore) unmarkSent(ctx context.Context, id uint64) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE weather_subscriptions SET last_sent_on = NULL WHERE id = ?", id)
+	return err
+}
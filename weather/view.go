@@ -0,0 +1,164 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/bot"
+)
+
+// MaxDays は1日ごとの天気予報で見せられる最大の日数
+const MaxDays = 5
+
+// View は天気予報の見せ方
+type View struct {
+	// Hourly が true のときはこれから24時間の予報を3時間ごとに見せる
+	// false のときは1日ごとに見せる
+	Hourly bool
+	// Days は1日ごとの予報を何日分見せるか (1〜MaxDays)
+	Days int
+	// From は何日後からの予報を見せるか
+	From int
+}
+
+// DefaultView は何も指定されなかったときの見せ方 (今日から3日分)
+var DefaultView = View{Days: 3}
+
+// 3時間ごとの予報を表す言葉
+var hourlyWords = []string{"3時間ごと", "時間ごと", "hourly"}
+
+// 日数を表す言葉 (例: 5日, 5日間, 5days)
+var daysPattern = regexp.MustCompile(`^([1-5])(日|日間|日分|days?|d)$`)
+
+// parseViewWord は word を見せ方を表す言葉として読み取り、view に反映する
+// 見せ方を表す言葉でないときは false を返す
+func parseViewWord(view *View, word string) bool {
+	lower := strings.ToLower(word)
+	for _, w := range hourlyWords {
+		if lower == w {
+			view.Hourly = true
+			return true
+		}
+	}
+	if m := daysPattern.FindStringSubmatch(lower); m != nil {
+		view.Days, _ = strconv.Atoi(m[1])
+		return true
+	}
+	if from, ok := dayWords[lower]; ok {
+		view.From = from
+		return true
+	}
+	return false
+}
+
+// label はクイックリプライのボタンに表示する見せ方の名前
+func (v View) label() string {
+	if v.Hourly {
+		return "3時間ごと"
+	}
+	if v.Days == 1 {
+		return "1日"
+	}
+	return fmt.Sprintf("%d日間", v.Days)
+}
+
+// PostbackAction は天気予報の見せ方を切り替えるポストバックの action
+// bot.PostbackRouter に Client.PostbackHandler と一緒に登録する
+const PostbackAction = "weather"
+
+// viewPostbackData は place (at) の天気予報を view の見せ方で答えるポストバックのデータをつくる
+func viewPostbackData(place string, at Coordinates, view View) string {
+	values := url.Values{}
+	values.Set("action", PostbackAction)
+	values.Set("lat", strconv.FormatFloat(at.Latitude, 'f', 4, 64))
+	values.Set("lon", strconv.FormatFloat(at.Longitude, 'f', 4, 64))
+	if place != "" {
+		values.Set("place", place)
+	}
+	if view.Hourly {
+		values.Set("view", "hourly")
+	} else {
+		values.Set("view", "daily")
+		values.Set("days", strconv.Itoa(view.Days))
+		values.Set("from", strconv.Itoa(view.From))
+	}
+	return values.Encode()
+}
+
+// parseViewPostback はポストバックのデータから場所と見せ方を読み取る
+func parseViewPostback(data string) (place string, at Coordinates, view View, ok bool) {
+	values, err := url.ParseQuery(data)
+	if err != nil || values.Get("action") != PostbackAction {
+		return "", Coordinates{}, View{}, false
+	}
+	lat, err := strconv.ParseFloat(values.Get("lat"), 64)
+	if err != nil {
+		return "", Coordinates{}, View{}, false
+	}
+	lon, err := strconv.ParseFloat(values.Get("lon"), 64)
+	if err != nil {
+		return "", Coordinates{}, View{}, false
+	}
+	view = DefaultView
+	if values.Get("view") == "hourly" {
+		view.Hourly = true
+	}
+	if days, err := strconv.Atoi(values.Get("days")); err == nil && days >= 1 && days <= MaxDays {
+		view.Days = days
+	}
+	if from, err := strconv.Atoi(values.Get("from")); err == nil && from >= 0 {
+		view.From = from
+	}
+	return values.Get("place"), Coordinates{Latitude: lat, Longitude: lon}, view, true
+}
+
+// viewQuickReplies は見せ方を切り替えるクイックリプライをつくる
+// current と同じ見せ方のボタンは付けない。current が nil のときはすべて付ける
+func viewQuickReplies(place string, at Coordinates, current *View) *linebot.QuickReplyItems {
+	from := 0
+	if current != nil {
+		from = current.From
+	}
+	views := []View{
+		{Hourly: true},
+		{Days: 1, From: from},
+		{Days: 3, From: from},
+		{Days: MaxDays, From: from},
+	}
+	buttons := make([]*linebot.QuickReplyButton, 0, len(views))
+	for _, view := range views {
+		if current != nil && view == *current {
+			continue
+		}
+		// 3時間ごとの予報は From を使わないので、日にちによらず同じ見せ方とみなす
+		if current != nil && view.Hourly && current.Hourly {
+			continue
+		}
+		label := view.label()
+		buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewPostbackAction(label, viewPostbackData(place, at, view), "", label, "", "")))
+	}
+	return linebot.NewQuickReplyItems(buttons...)
+}
+
+// PostbackHandler はクイックリプライで選ばれた見せ方で天気予報を返信する
+// bot.PostbackHandler として PostbackAction に登録する
+func (c *Client) PostbackHandler(ctx context.Context, event *linebot.Event, postback *linebot.Postback) linebot.SendingMessage {
+	place, at, view, ok := parseViewPostback(postback.Data)
+	if !ok {
+		return nil
+	}
+	replyMessage, err := c.forecastMessage(ctx, at, view, c.unitsFor(ctx, bot.SourceID(event.Source)))
+	if err != nil {
+		return errorReply(err)
+	}
+	if place != "" {
+		replyMessage.AltText = place + "の天気予報"
+	}
+	return replyMessage
+}
@@ -0,0 +1,158 @@
+// Package weathertest はネットワークを使わずに天気確認機能を確かめるための部品をまとめたパッケージ
+//
+// OpenWeatherMapAPIと気象庁から実際に返ってくる形のフィクスチャ(fixtures/)を用意している。
+// Transport はそれを返す http.RoundTripper で、weather.WithHTTPClient に渡すと
+// 本物の Provider がネットワークの代わりにフィクスチャを読む。
+// Fake はフィクスチャを返す weather.Provider で、呼び出し回数の記録や失敗の再現ができる
+package weathertest
+
+import (
+	"context"
+	"embed"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/xxarupakaxx/sysad-linebot-handson/weather"
+)
+
+//go:embed fixtures
+var fixtures embed.FS
+
+// フィクスチャの日時
+// OpenWeatherMapの予報は 2023-02-20 15:00 (日本時間) から3時間ごと5日分、
+// OpenWeatherMapのフィクスチャは units=metric, lang=ja で取得した形 (気温は℃、説明は日本語)
+// 気象庁の予報は 2023-02-20 11:00 発表の東京都のもの
+var fixtureFiles = map[string]string{
+	"/data/2.5/weather":                    "fixtures/owm_current.json",
+	"/data/2.5/forecast":                   "fixtures/owm_forecast.json",
+	"/bosai/amedas/const/amedastable.json": "fixtures/amedastable.json",
+	"/bosai/amedas/data/latest_time.txt":   "fixtures/latest_time.txt",
+}
+
+// fixtureFor は path のリクエストに返すフィクスチャのファイル名を返す
+// 気象庁の予報とアメダスの観測値は、どの地方・時刻を指定しても同じものを返す
+func fixtureFor(path string) (string, bool) {
+	if name, ok := fixtureFiles[path]; ok {
+		return name, true
+	}
+	switch {
+	case strings.HasPrefix(path, "/bosai/forecast/data/forecast/"):
+		return "fixtures/jma_forecast.json", true
+	case strings.HasPrefix(path, "/bosai/amedas/data/map/"):
+		return "fixtures/amedas_map.json", true
+	}
+	return "", false
+}
+
+// Transport はリクエストのパスに合ったフィクスチャを返す http.RoundTripper
+// ホスト名やクエリは見ない。フィクスチャがないパスには 404 を返す
+type Transport struct{}
+
+// RoundTrip はフィクスチャをレスポンスとして返す
+func (Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Request:    req,
+	}
+	name, ok := fixtureFor(req.URL.Path)
+	if !ok {
+		res.StatusCode = http.StatusNotFound
+		res.Status = "404 Not Found"
+		res.Body = http.NoBody
+		return res, nil
+	}
+	file, err := fixtures.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	res.StatusCode = http.StatusOK
+	res.Status = "200 OK"
+	res.Body = file
+	return res, nil
+}
+
+// HTTPClient は Transport を使う http.Client を返す
+func HTTPClient() *http.Client {
+	return &http.Client{Transport: Transport{}}
+}
+
+// Fake はフィクスチャを返す weather.Provider
+// 中身は Transport につないだ本物の Provider なので、変換の処理も本物と同じように動く
+type Fake struct {
+	provider weather.Provider
+
+	mu    sync.Mutex
+	err   error
+	calls map[string]int
+}
+
+// New はOpenWeatherMapAPIのフィクスチャを返す Fake をつくる
+func New() *Fake {
+	return newFake(weather.NewOpenWeatherMap("fixture", weather.WithHTTPClient(HTTPClient())))
+}
+
+// NewJMA は気象庁のフィクスチャを返す Fake をつくる
+func NewJMA() *Fake {
+	return newFake(weather.NewJMA(weather.WithHTTPClient(HTTPClient())))
+}
+
+func newFake(provider weather.Provider) *Fake {
+	return &Fake{provider: provider, calls: map[string]int{}}
+}
+
+// Unwrap はフィクスチャを読む本物の Provider を返す
+// weather.Cache は Hourly の結果から Daily を作れるかをこれで確かめる
+func (f *Fake) Unwrap() weather.Provider {
+	return f.provider
+}
+
+// Fail は以降の呼び出しで err を返すようにする
+// nil を渡すとフィクスチャを返すように戻る
+func (f *Fake) Fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Calls は method ("Current", "Hourly", "Daily") が呼び出された回数を返す
+func (f *Fake) Calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+// call は呼び出しを記録し、Fail で設定されたエラーを返す
+func (f *Fake) call(method string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[method]++
+	return f.err
+}
+
+// Current はフィクスチャの現在の天気を返す
+func (f *Fake) Current(ctx context.Context, at weather.Coordinates) (*weather.Conditions, error) {
+	if err := f.call("Current"); err != nil {
+		return nil, err
+	}
+	return f.provider.Current(ctx, at)
+}
+
+// Hourly はフィクスチャの数時間ごとの天気予報を返す
+func (f *Fake) Hourly(ctx context.Context, at weather.Coordinates) (*weather.HourlyForecast, error) {
+	if err := f.call("Hourly"); err != nil {
+		return nil, err
+	}
+	return f.provider.Hourly(ctx, at)
+}
+
+// Daily はフィクスチャの1日ごとの天気予報を返す
+func (f *Fake) Daily(ctx context.Context, at weather.Coordinates) (*weather.DailyForecast, error) {
+	if err := f.call("Daily"); err != nil {
+		return nil, err
+	}
+	return f.provider.Daily(ctx, at)
+}